@@ -8,32 +8,58 @@ import (
 // It is guaranteed that two concurrent calls to Balancer.Next will not return the same
 // item, when the slice contains more than one item.
 type Balancer[T any] struct {
-	items []T
+	items atomic.Pointer[[]T]
 	idx   atomic.Uint64
 }
 
 // NewBalancer creates a new Balancer instance.
 func NewBalancer[T any](items ...T) *Balancer[T] {
-	return &Balancer[T]{
-		items: items,
-	}
+	b := &Balancer[T]{}
+	b.items.Store(&items)
+
+	return b
 }
 
 // Current returns the current item in the slice, without advancing the Loadbalancer.
 func (b *Balancer[T]) Current() T {
+	items := *b.items.Load()
 	idx := b.idx.Load()
-	key := idx % uint64(len(b.items))
+	key := idx % uint64(len(items))
 
-	return b.items[key]
+	return items[key]
 }
 
 // Next returns the next item in the slice.
 // When the end of the slice is reached, it starts again from the beginning.
 func (b *Balancer[T]) Next() T {
+	items, key := b.next()
+
+	return items[key]
+}
+
+// next advances the Balancer, returning the current items along with the
+// position of the next one.
+func (b *Balancer[T]) next() ([]T, int) {
+	items := *b.items.Load()
 	idx := b.idx.Add(1) - 1
-	key := idx % uint64(len(b.items))
 
-	return b.items[key]
+	if len(items) == 0 {
+		return items, 0
+	}
+
+	return items, int(idx % uint64(len(items)))
+}
+
+// Len returns the number of items in the slice.
+func (b *Balancer[T]) Len() int {
+	return len(*b.items.Load())
+}
+
+// Update atomically replaces the items of the Balancer, calls in progress
+// keep using the previous items. The given slice must not be modified
+// afterward.
+func (b *Balancer[T]) Update(items ...T) {
+	b.items.Store(&items)
 }
 
 // Reset resets the Balancer to its initial state.
@@ -44,3 +44,19 @@ func TestBalancer_Next_ThreadSafe(t *testing.T) {
 		t.Errorf("expected %d, got %d", 1337, lb.Next())
 	}
 }
+
+func TestBalancer_Update(t *testing.T) {
+	lb := grpcx.NewBalancer[int](1, 2)
+
+	if got := lb.Next(); got != 1 {
+		t.Errorf("expected %d, got %d", 1, got)
+	}
+
+	lb.Update(3, 4, 5)
+
+	for _, want := range []int{4, 5, 3} {
+		if got := lb.Next(); got != want {
+			t.Errorf("expected %d, got %d", want, got)
+		}
+	}
+}
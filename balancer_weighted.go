@@ -0,0 +1,106 @@
+package grpcx
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+// WeightedRoundRobinBalancerName is the name of the load balancing policy
+// that distributes calls among addresses in proportion to their weight, see
+// AddressWeight. Weights are given by resolvers, such as the file and SRV
+// resolvers of this package, so no load reports from servers are needed.
+//
+// Using a connection string:
+//
+//	grpc://?resolver.scheme=file&resolver.path=/etc/backends.json&defaultServiceConfig=lbp-grpcx_weighted_round_robin
+const WeightedRoundRobinBalancerName = "grpcx_weighted_round_robin"
+
+// addressWeightKey is the key of the attribute holding the weight of an
+// address, see AddressWeight.
+type addressWeightKey struct{}
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(WeightedRoundRobinBalancerName, weightedPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// AddressWeight returns the weight attached to the given address by the file
+// or SRV resolvers, 1 if none. Addresses with a weight of zero only receive
+// calls when every other address also has a weight of zero, or is not ready.
+func AddressWeight(addr resolver.Address) uint32 {
+	if w, ok := addr.Attributes.Value(addressWeightKey{}).(uint32); ok {
+		return w
+	}
+
+	return 1
+}
+
+// withAddressWeight attaches the given weight to the address.
+func withAddressWeight(addr resolver.Address, weight uint32) resolver.Address {
+	addr.Attributes = addr.Attributes.WithValue(addressWeightKey{}, weight)
+
+	return addr
+}
+
+type weightedPickerBuilder struct{}
+
+func (weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := &weightedPicker{}
+
+	for sc, sci := range info.ReadySCs {
+		p.subConns = append(p.subConns, weightedSubConn{subConn: sc, weight: int64(AddressWeight(sci.Address))})
+		p.total += int64(AddressWeight(sci.Address))
+	}
+
+	// Ready addresses all have a weight of zero, so calls are spread evenly.
+	if p.total == 0 {
+		for i := range p.subConns {
+			p.subConns[i].weight = 1
+		}
+
+		p.total = int64(len(p.subConns))
+	}
+
+	return p
+}
+
+// weightedPicker picks connections using smooth weighted round-robin, which
+// interleaves picks instead of sending consecutive calls to the heaviest
+// connection.
+type weightedPicker struct {
+	mu       sync.Mutex
+	subConns []weightedSubConn
+	total    int64
+}
+
+type weightedSubConn struct {
+	subConn balancer.SubConn
+	weight  int64
+	current int64
+}
+
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *weightedSubConn
+
+	for i := range p.subConns {
+		sc := &p.subConns[i]
+		sc.current += sc.weight
+
+		if best == nil || sc.current > best.current {
+			best = sc
+		}
+	}
+
+	best.current -= p.total
+
+	return balancer.PickResult{SubConn: best.subConn}, nil
+}
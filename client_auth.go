@@ -0,0 +1,218 @@
+package grpcx
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// Supported authentication methods, see AuthConfig.
+const (
+	// AuthBearer sends a static bearer token, or one read from a file that is
+	// re-read whenever it changes.
+	AuthBearer = "bearer"
+
+	// AuthOAuth2 obtains tokens using the OAuth2 client credentials flow.
+	// Tokens are cached until they expire.
+	AuthOAuth2 = "oauth2"
+)
+
+// AuthConfig describes the per-RPC credentials attached to every call made
+// through a connection.
+type AuthConfig struct {
+	// Method authentication method, either AuthBearer or AuthOAuth2.
+	Method string
+
+	// Token static bearer token. Only valid for AuthBearer.
+	Token string
+
+	// TokenFile path to a file holding the bearer token, re-read whenever it
+	// changes so rotated tokens are picked up. Only valid for AuthBearer.
+	TokenFile string
+
+	// TokenURL, ClientID, ClientSecret and Scopes are the OAuth2 client
+	// credentials used to obtain tokens. Only valid for AuthOAuth2.
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// perRPCCredentials returns the per-RPC credentials to be attached to calls
+// made using this config, nil if none.
+func (cfg ClientConfig) perRPCCredentials() credentials.PerRPCCredentials {
+	if cfg.PerRPCCredentials != nil {
+		return cfg.PerRPCCredentials
+	}
+
+	if cfg.Auth != nil {
+		return cfg.Auth.credentials(!cfg.Insecure)
+	}
+
+	return nil
+}
+
+// credentials builds the per-RPC credentials described by this config. When
+// requireTLS is set, credentials are only sent over secure connections.
+func (ac *AuthConfig) credentials(requireTLS bool) credentials.PerRPCCredentials {
+	var source oauth2.TokenSource
+
+	switch {
+	case ac.Method == AuthOAuth2:
+		cc := &clientcredentials.Config{
+			ClientID:     ac.ClientID,
+			ClientSecret: ac.ClientSecret,
+			TokenURL:     ac.TokenURL,
+			Scopes:       ac.Scopes,
+		}
+
+		source = cc.TokenSource(context.Background())
+	case ac.TokenFile != "":
+		source = &fileTokenSource{path: ac.TokenFile}
+	default:
+		source = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: ac.Token, TokenType: "Bearer"})
+	}
+
+	return &tokenCredentials{source: source, requireTLS: requireTLS}
+}
+
+// validate checks that this config holds every setting required by its
+// method, reporting problems through the given function.
+func (ac *AuthConfig) validate(invalid func(option, value, reason string, err error)) {
+	switch ac.Method {
+	case AuthBearer:
+		if (ac.Token == "") == (ac.TokenFile == "") {
+			invalid("auth", ac.Method, "bearer authentication requires either auth.token or auth.tokenFile", nil)
+		}
+
+		if ac.TokenURL != "" || ac.ClientID != "" || ac.ClientSecret != "" || len(ac.Scopes) > 0 {
+			invalid("auth", ac.Method, "auth.tokenURL, auth.clientID, auth.clientSecret and auth.scopes are only valid for oauth2 authentication", nil)
+		}
+	case AuthOAuth2:
+		if ac.TokenURL == "" || ac.ClientID == "" || ac.ClientSecret == "" {
+			invalid("auth", ac.Method, "oauth2 authentication requires auth.tokenURL, auth.clientID and auth.clientSecret", nil)
+		}
+
+		if ac.Token != "" || ac.TokenFile != "" {
+			invalid("auth", ac.Method, "auth.token and auth.tokenFile are only valid for bearer authentication", nil)
+		}
+	default:
+		invalid("auth", ac.Method, "expecting `bearer` or `oauth2`", nil)
+	}
+}
+
+// authOptions adds the options that represent the given auth config.
+func authOptions(q url.Values, ac *AuthConfig, redact bool) {
+	secret := func(v string) string {
+		if redact && v != "" {
+			return redactedValue
+		}
+
+		return v
+	}
+
+	q.Set("auth", ac.Method)
+
+	if ac.Token != "" {
+		q.Set("auth.token", secret(ac.Token))
+	}
+
+	if ac.TokenFile != "" {
+		q.Set("auth.tokenFile", ac.TokenFile)
+	}
+
+	if ac.TokenURL != "" {
+		q.Set("auth.tokenURL", ac.TokenURL)
+	}
+
+	if ac.ClientID != "" {
+		q.Set("auth.clientID", ac.ClientID)
+	}
+
+	if ac.ClientSecret != "" {
+		q.Set("auth.clientSecret", secret(ac.ClientSecret))
+	}
+
+	if len(ac.Scopes) > 0 {
+		q.Set("auth.scopes", strings.Join(ac.Scopes, ","))
+	}
+}
+
+// inferAuthMethod returns the authentication method implied by the given
+// settings, used when auth.* options are given without `auth`.
+func inferAuthMethod(ac *AuthConfig) string {
+	if ac.TokenURL != "" || ac.ClientID != "" || ac.ClientSecret != "" {
+		return AuthOAuth2
+	}
+
+	return AuthBearer
+}
+
+// tokenCredentials implements credentials.PerRPCCredentials on top of an
+// OAuth2 token source.
+type tokenCredentials struct {
+	source     oauth2.TokenSource
+	requireTLS bool
+}
+
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	if c.requireTLS {
+		ri, _ := credentials.RequestInfoFromContext(ctx)
+		if err := credentials.CheckSecurityLevel(ri.AuthInfo, credentials.PrivacyAndIntegrity); err != nil {
+			return nil, fmt.Errorf("unable to transfer per-RPC credentials, details = %w", err)
+		}
+	}
+
+	token, err := c.source.Token()
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "could not obtain token, details = %v", err)
+	}
+
+	return map[string]string{"authorization": token.Type() + " " + token.AccessToken}, nil
+}
+
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// fileTokenSource is an oauth2.TokenSource that reads a bearer token from a
+// file, re-reading it whenever the file changes. If the file cannot be read,
+// the last known token is used.
+type fileTokenSource struct {
+	path string
+
+	mu    sync.Mutex
+	token *oauth2.Token
+	stamp fileStamp
+}
+
+func (s *fileTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if info, err := os.Stat(s.path); err == nil {
+		current := fileStamp{modTime: info.ModTime(), size: info.Size()}
+
+		if s.token == nil || !current.modTime.Equal(s.stamp.modTime) || current.size != s.stamp.size {
+			if v, rErr := readFileValue(s.path); rErr == nil && v != "" {
+				s.token = &oauth2.Token{AccessToken: v, TokenType: "Bearer"}
+				s.stamp = current
+			}
+		}
+	}
+
+	if s.token == nil {
+		return nil, fmt.Errorf("could not read token from file `%s`", s.path)
+	}
+
+	return s.token, nil
+}
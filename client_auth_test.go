@@ -0,0 +1,136 @@
+package grpcx_test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Avalanche-io/counter"
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestParseClientConfig_Auth(t *testing.T) {
+	t.Run("it should parse oauth2 credentials", func(t *testing.T) {
+		cfg, err := grpcx.ParseClientConfig("grpc://example.com:443?auth=oauth2&auth.tokenURL=https://idp.example.com/token&auth.clientID=billing&auth.clientSecret=s3cr3t&auth.scopes=read,write")
+		require.NoError(t, err)
+		require.Equal(t, &grpcx.AuthConfig{
+			Method:       grpcx.AuthOAuth2,
+			TokenURL:     "https://idp.example.com/token",
+			ClientID:     "billing",
+			ClientSecret: "s3cr3t",
+			Scopes:       []string{"read", "write"},
+		}, cfg.Auth)
+
+		require.Contains(t, cfg.DSN(), "auth.clientSecret=s3cr3t")
+		require.NotContains(t, cfg.Redacted(), "s3cr3t")
+	})
+
+	t.Run("it should infer the method from the given options", func(t *testing.T) {
+		tokenFile := writeTestFile(t, t.TempDir(), "token", []byte("s3cr3t"))
+
+		cfg, err := grpcx.ParseClientConfig("grpc://example.com:443?auth.tokenFile=" + tokenFile)
+		require.NoError(t, err)
+		require.Equal(t, grpcx.AuthBearer, cfg.Auth.Method)
+	})
+
+	t.Run("it should reject incomplete or unknown methods", func(t *testing.T) {
+		_, err := grpcx.ParseClientConfig("grpc://example.com:443?auth=oauth2&auth.tokenURL=https://idp.example.com/token")
+		require.ErrorIs(t, err, grpcx.ErrInvalidClientConnectionString)
+		require.ElementsMatch(t, []string{"auth"}, optionErrorNames(err))
+
+		_, err = grpcx.ParseClientConfig("grpc://example.com:443?auth=basic")
+		require.ElementsMatch(t, []string{"auth"}, optionErrorNames(err))
+	})
+}
+
+func TestParseClientConfigDial_OAuth2(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tokenRequests := counter.NewUnsigned()
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests.Add(1)
+
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"access_token":"t0k3n","token_type":"bearer","expires_in":3600}`)
+	}))
+	defer idp.Close()
+
+	tokens := make(chan string, 2)
+	addr, _ := startTestServer(t, "127.0.0.1:0", grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		tokens <- strings.Join(md.Get("authorization"), ",")
+
+		return handler(ctx, req)
+	}))
+
+	conn, err := grpcx.ParseClientConfigDial(ctx, fmt.Sprintf("grpc://%s?tls=false&auth=oauth2&auth.tokenURL=%s&auth.clientID=billing&auth.clientSecret=s3cr3t", addr, idp.URL))
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	for i := 0; i < 2; i++ {
+		_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+		require.Equal(t, "Bearer t0k3n", <-tokens)
+	}
+
+	require.EqualValues(t, 1, tokenRequests.Get())
+}
+
+func TestParseClientConfigDial_BearerOverTLS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	server := newTestLeaf(t, ca, "localhost")
+	caFile := writeTestFile(t, dir, "ca.crt", ca.certPEM)
+	tokenFile := writeTestFile(t, dir, "token", []byte("first\n"))
+
+	tokens := make(chan string, 2)
+	addr, _ := startTestServer(t, "127.0.0.1:0",
+		grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{server.tlsCertificate(t)}, MinVersion: tls.VersionTLS12})),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			tokens <- strings.Join(md.Get("authorization"), ",")
+
+			return handler(ctx, req)
+		}),
+	)
+
+	conn, err := grpcx.ParseClientConfigDial(ctx, fmt.Sprintf("grpc://%s?tls.rootCAs=%s&tls.serverName=localhost&auth=bearer&auth.tokenFile=%s", addr, caFile, tokenFile))
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "Bearer first", <-tokens)
+
+	writeTestFile(t, dir, "token", []byte("rotated\n"))
+
+	_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "Bearer rotated", <-tokens)
+}
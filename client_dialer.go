@@ -4,59 +4,156 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 
 	"github.com/tangelo-labs/go-grpcx/interception/headers"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
 )
 
+// staticResolverScheme is the scheme of the resolver used when dialing
+// multiple fixed addresses.
+const staticResolverScheme = "grpcx-static"
+
 // Dialer is used to control the dialing process of a gRPC backend connection.
 type Dialer struct {
 	cfg                *ClientConfig
 	unaryInterceptors  []grpc.UnaryClientInterceptor
 	streamInterceptors []grpc.StreamClientInterceptor
 	options            []grpc.DialOption
+	tlsReloader        *tlsReloader
+	perRPCCredentials  credentials.PerRPCCredentials
+	stateHooks         []StateChangeFunc
+}
+
+// StateChangeFunc is called when a connection moves from one connectivity
+// state to another.
+type StateChangeFunc func(target string, from, to connectivity.State)
+
+// Clone returns a copy of the dialer, including a deep copy of its config,
+// that can be tweaked independently.
+//
+// The With* methods and OnStateChange already return a modified clone and
+// leave the receiver untouched, so several dialers can be derived from a
+// common base, e.g. one with authentication interceptors, without calling
+// Clone:
+//
+//	base := cfg.NewDialer().WithUnaryInterceptors(authInterceptor)
+//	billing := base.WithUnaryInterceptors(billingInterceptor)
+//	orders := base.WithOptions(grpc.WithUserAgent("orders"))
+func (d *Dialer) Clone() *Dialer {
+	cfg := d.cfg.clone()
+
+	c := *d
+	c.cfg = &cfg
+
+	return &c
+}
+
+// Config returns a deep copy of the config used by the dialer, changes to the
+// returned value do not affect the dialer.
+func (d *Dialer) Config() ClientConfig {
+	return d.cfg.clone()
 }
 
-// WithOptions adds additional dial options to the dialer.
+// WithOptions returns a copy of the dialer with additional dial options, the
+// receiver is left untouched.
 func (d *Dialer) WithOptions(options ...grpc.DialOption) *Dialer {
-	d.options = append(d.options, options...)
+	c := d.Clone()
+	c.options = append(c.options[:len(c.options):len(c.options)], options...)
 
-	return d
+	return c
 }
 
-// WithUnaryInterceptors adds additional unary interceptors to the dialer.
+// WithUnaryInterceptors returns a copy of the dialer with additional unary
+// interceptors, the receiver is left untouched.
 func (d *Dialer) WithUnaryInterceptors(interceptors ...grpc.UnaryClientInterceptor) *Dialer {
-	d.unaryInterceptors = append(d.unaryInterceptors, interceptors...)
+	c := d.Clone()
+	c.unaryInterceptors = append(c.unaryInterceptors[:len(c.unaryInterceptors):len(c.unaryInterceptors)], interceptors...)
 
-	return d
+	return c
 }
 
-// WithStreamInterceptors adds additional stream interceptors to the dialer.
+// WithStreamInterceptors returns a copy of the dialer with additional stream
+// interceptors, the receiver is left untouched.
 func (d *Dialer) WithStreamInterceptors(interceptors ...grpc.StreamClientInterceptor) *Dialer {
-	d.streamInterceptors = append(d.streamInterceptors, interceptors...)
+	c := d.Clone()
+	c.streamInterceptors = append(c.streamInterceptors[:len(c.streamInterceptors):len(c.streamInterceptors)], interceptors...)
 
-	return d
+	return c
+}
+
+// OnStateChange returns a copy of the dialer that calls the given function on
+// every connectivity state transition of the connections it creates, including
+// each member of a pool (see DialPool). The receiver is left untouched.
+//
+// Transitions are reported in order from a dedicated goroutine per connection,
+// as observed by grpc.ClientConn.WaitForStateChange, so short-lived states may
+// be skipped. The goroutine stops once the connection is closed, after
+// reporting the transition to connectivity.Shutdown.
+func (d *Dialer) OnStateChange(fn StateChangeFunc) *Dialer {
+	c := d.Clone()
+	c.stateHooks = append(c.stateHooks[:len(c.stateHooks):len(c.stateHooks)], fn)
+
+	return c
 }
 
 // Dial dials the backend using the given context and returns a *grpc.ClientConn
-// instance. Note that the context is only used to dial the connection, it is
-// not used to control the connection lifecycle.
+// instance. Note that the context is only used to wait for the connection to
+// become ready when ClientConfig.Blocking is set (see DialAndWait), it is not
+// used to control the connection lifecycle.
+//
+// The underlying ClientConfig is validated before dialing, see
+// ClientConfig.Validate.
 func (d *Dialer) Dial(ctx context.Context) (*grpc.ClientConn, error) {
-	scheme := ""
-	if d.cfg.ResolverScheme != "" {
-		scheme = fmt.Sprintf("%s:///", d.cfg.ResolverScheme)
+	if d.cfg.Blocking {
+		return d.DialAndWait(ctx)
 	}
 
-	target := fmt.Sprintf("%s%s:%d", scheme, d.cfg.Host, d.cfg.Port)
+	conn, _, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	conn.Connect()
+
+	return conn, nil
+}
+
+// dial validates the config and creates a new idle connection, along with the
+// recorder of its connection failures.
+func (d *Dialer) dial() (*grpc.ClientConn, *dialFailures, error) {
+	if err := d.cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	target := d.cfg.target()
 	additionalOptions := d.options
+
+	if len(d.cfg.Addresses) > 1 {
+		r := manual.NewBuilderWithScheme(staticResolverScheme)
+		r.InitialState(resolver.State{Addresses: staticAddresses(d.cfg.Addresses)})
+
+		target = fmt.Sprintf("%s:///%s", staticResolverScheme, net.JoinHostPort(d.cfg.Host, strconv.Itoa(d.cfg.Port)))
+		additionalOptions = append(additionalOptions, grpc.WithResolvers(r))
+	}
+
 	unaryInterceptors := d.unaryInterceptors
 	streamInterceptors := d.streamInterceptors
+	failures := &dialFailures{}
 
 	if d.cfg.Insecure {
-		additionalOptions = append(additionalOptions, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		additionalOptions = append(additionalOptions, grpc.WithTransportCredentials(&recordingCredentials{
+			TransportCredentials: insecure.NewCredentials(),
+			failures:             failures,
+		}))
 	}
 
 	if !d.cfg.Insecure {
@@ -65,19 +162,15 @@ func (d *Dialer) Dial(ctx context.Context) (*grpc.ClientConn, error) {
 			tlsCfg = d.cfg.TLS.Clone()
 		}
 
-		cred := credentials.NewTLS(tlsCfg)
-		additionalOptions = append(additionalOptions, grpc.WithTransportCredentials(cred))
-	}
-
-	if d.cfg.Blocking {
-		additionalOptions = append(additionalOptions, grpc.WithBlock())
-
-		if d.cfg.Timeout > 0 {
-			c, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
-			defer cancel()
-
-			ctx = c
+		if d.tlsReloader != nil {
+			d.tlsReloader.apply(tlsCfg, d.serverName())
 		}
+
+		cred := credentials.NewTLS(tlsCfg)
+		additionalOptions = append(additionalOptions, grpc.WithTransportCredentials(&recordingCredentials{
+			TransportCredentials: cred,
+			failures:             failures,
+		}))
 	}
 
 	if d.cfg.Authority != "" {
@@ -92,8 +185,47 @@ func (d *Dialer) Dial(ctx context.Context) (*grpc.ClientConn, error) {
 		additionalOptions = append(additionalOptions, grpc.WithMaxHeaderListSize(d.cfg.MaxHeaderListSize))
 	}
 
-	if d.cfg.DefaultServiceConfig != "" {
-		additionalOptions = append(additionalOptions, grpc.WithDefaultServiceConfig(d.cfg.DefaultServiceConfig))
+	var callOptions []grpc.CallOption
+
+	if d.cfg.MaxRecvMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallRecvMsgSize(d.cfg.MaxRecvMsgSize))
+	}
+
+	if d.cfg.MaxSendMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallSendMsgSize(d.cfg.MaxSendMsgSize))
+	}
+
+	if d.cfg.Compressor != "" {
+		callOptions = append(callOptions, grpc.UseCompressor(d.cfg.Compressor))
+	}
+
+	if len(callOptions) > 0 {
+		additionalOptions = append(additionalOptions, grpc.WithDefaultCallOptions(callOptions...))
+	}
+
+	if d.cfg.InitialWindowSize > 0 {
+		additionalOptions = append(additionalOptions, grpc.WithInitialWindowSize(d.cfg.InitialWindowSize))
+	}
+
+	if d.cfg.InitialConnWindowSize > 0 {
+		additionalOptions = append(additionalOptions, grpc.WithInitialConnWindowSize(d.cfg.InitialConnWindowSize))
+	}
+
+	if d.cfg.ReadBufferSize > 0 {
+		additionalOptions = append(additionalOptions, grpc.WithReadBufferSize(d.cfg.ReadBufferSize))
+	}
+
+	if d.cfg.WriteBufferSize > 0 {
+		additionalOptions = append(additionalOptions, grpc.WithWriteBufferSize(d.cfg.WriteBufferSize))
+	}
+
+	serviceConfig, err := d.cfg.ServiceConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if serviceConfig != "" {
+		additionalOptions = append(additionalOptions, grpc.WithDefaultServiceConfig(serviceConfig))
 	}
 
 	if d.cfg.KeepAliveTimeout > 0 || d.cfg.KeepAliveInterval > 0 {
@@ -110,7 +242,18 @@ func (d *Dialer) Dial(ctx context.Context) (*grpc.ClientConn, error) {
 		additionalOptions = append(additionalOptions, grpc.WithKeepaliveParams(params))
 	}
 
-	if len(d.cfg.Headers) > 0 {
+	if dial := contextDialer(d.cfg.Proxy); dial != nil {
+		additionalOptions = append(additionalOptions, grpc.WithContextDialer(failures.contextDialer(dial)))
+	}
+
+	if d.perRPCCredentials != nil {
+		additionalOptions = append(additionalOptions, grpc.WithPerRPCCredentials(d.perRPCCredentials))
+	}
+
+	if fh := newFileHeaders(d.cfg.Headers); fh != nil {
+		unaryInterceptors = append(unaryInterceptors, headers.UnaryClientInterceptorFunc(fh.get))
+		streamInterceptors = append(streamInterceptors, headers.StreamClientInterceptorFunc(fh.get))
+	} else if len(d.cfg.Headers) > 0 {
 		unaryInterceptors = append(unaryInterceptors, headers.UnaryClientInterceptor(d.cfg.Headers))
 		streamInterceptors = append(streamInterceptors, headers.StreamClientInterceptor(d.cfg.Headers))
 	}
@@ -123,26 +266,105 @@ func (d *Dialer) Dial(ctx context.Context) (*grpc.ClientConn, error) {
 		additionalOptions = append(additionalOptions, grpc.WithChainStreamInterceptor(streamInterceptors...))
 	}
 
-	return grpc.DialContext(ctx, target, additionalOptions...)
+	conn, err := grpc.NewClient(target, additionalOptions...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(d.stateHooks) > 0 {
+		go watchStateChanges(conn, conn.GetState(), d.stateHooks)
+	}
+
+	return conn, failures, nil
 }
 
-// DialPool dials the backend using the given context and returns a ClientConn
-// implementation that uses a pool of grpc.ClientConn instances when calling "Invoke" and
-// "NewStream".
-//
-// This allows to have multiple connections to the same backend, and distribute the
-// requests between connections.
-func (d *Dialer) DialPool(ctx context.Context, poolSize int) (ClientConn, error) {
-	conns := make([]*grpc.ClientConn, poolSize)
-
-	for i := 0; i < poolSize; i++ {
-		conn, err := d.Dial(ctx)
-		if err != nil {
-			return nil, err
+// watchStateChanges reports the state transitions of the given connection,
+// starting from the given state, until the connection is closed.
+func watchStateChanges(conn *grpc.ClientConn, from connectivity.State, hooks []StateChangeFunc) {
+	for from != connectivity.Shutdown && conn.WaitForStateChange(context.Background(), from) {
+		to := conn.GetState()
+
+		for _, hook := range hooks {
+			hook(conn.Target(), from, to)
 		}
 
-		conns[i] = conn
+		from = to
+	}
+}
+
+// resolverPath returns the path of the dial target, honoring the deprecated
+// ResolverEndpoint field.
+func (cfg *ClientConfig) resolverPath() string {
+	if cfg.ResolverPath == "" {
+		return cfg.ResolverEndpoint
+	}
+
+	return cfg.ResolverPath
+}
+
+// target builds the dial target of the given config, in the form
+// `scheme://authority/path` when a resolver scheme is given, where the path
+// defaults to `host:port`. Targets without a resolver scheme are not resolved
+// and are dialed as is, using the passthrough resolver. Relative unix socket
+// paths are given as `unix:path`, the form gRPC expects for them.
+func (cfg *ClientConfig) target() string {
+	path := cfg.resolverPath()
+	if path == "" {
+		path = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	}
+
+	if cfg.ResolverScheme == "" {
+		return "passthrough:///" + path
+	}
+
+	if cfg.ResolverScheme == "unix" && !strings.HasPrefix(path, "/") {
+		return "unix:" + path
+	}
+
+	return fmt.Sprintf("%s://%s/%s", cfg.ResolverScheme, cfg.ResolverAuthority, strings.TrimPrefix(path, "/"))
+}
+
+// staticAddresses converts the given list of `host:port` strings into resolver
+// addresses.
+func staticAddresses(addresses []string) []resolver.Address {
+	out := make([]resolver.Address, len(addresses))
+	for i := range addresses {
+		out[i] = resolver.Address{Addr: addresses[i]}
+	}
+
+	return out
+}
+
+// serverName returns the name used to verify server certificates when none
+// is explicitly configured, which is the host part of the authority if given,
+// or the target host otherwise.
+func (d *Dialer) serverName() string {
+	if d.cfg.Authority == "" {
+		return d.cfg.Host
+	}
+
+	host, _, err := net.SplitHostPort(d.cfg.Authority)
+	if err != nil {
+		return d.cfg.Authority
+	}
+
+	return host
+}
+
+// DialConn dials the backend honoring the ClientConfig.PoolSize setting. When
+// PoolSize is greater than one, or connections have a maximum age, a pool of
+// connections is returned (see DialPool), otherwise a single
+// *grpc.ClientConn is dialed (see Dial). Pools can be type-asserted to
+// ClientConnPool to shut them down gracefully.
+func (d *Dialer) DialConn(ctx context.Context) (ClientConn, error) {
+	if d.cfg.PoolSize > 1 || d.cfg.PoolMaxConnectionAge > 0 {
+		return d.DialPool(ctx, max(d.cfg.PoolSize, 1), d.cfg.poolOptions()...)
+	}
+
+	conn, err := d.Dial(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return NewClientConnPool(conns...), nil
+	return conn, nil
 }
@@ -0,0 +1,460 @@
+package grpcx_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestDialer_OnStateChange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("it should report transitions until the connection is closed", func(t *testing.T) {
+		addr, _ := startTestServer(t, "127.0.0.1:0")
+
+		cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&timeout=5s")
+		require.NoError(t, err)
+
+		rec := &stateRecorder{}
+
+		conn, err := cfg.NewDialer().OnStateChange(rec.record).Dial(ctx)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return rec.reached(connectivity.Ready) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, conn.Close())
+
+		require.Eventually(t, func() bool {
+			return rec.reached(connectivity.Shutdown) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		transitions := rec.all()
+		require.Equal(t, connectivity.Idle, transitions[0].from)
+
+		for i := 1; i < len(transitions); i++ {
+			require.Equal(t, transitions[i-1].to, transitions[i].from)
+		}
+	})
+
+	t.Run("it should report transient failures", func(t *testing.T) {
+		addr := closedTestAddr(t)
+
+		cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&blocking=false")
+		require.NoError(t, err)
+
+		rec := &stateRecorder{}
+
+		conn, err := cfg.NewDialer().OnStateChange(rec.record).Dial(ctx)
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		require.Eventually(t, func() bool {
+			return rec.reached(connectivity.TransientFailure) > 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.Contains(t, rec.all()[0].target, addr)
+	})
+
+	t.Run("it should report transitions of every pool member", func(t *testing.T) {
+		addr, _ := startTestServer(t, "127.0.0.1:0")
+
+		cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&timeout=5s")
+		require.NoError(t, err)
+
+		rec := &stateRecorder{}
+
+		pool, err := cfg.NewDialer().OnStateChange(rec.record).DialPool(ctx, 3)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return rec.reached(connectivity.Ready) == 3
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, pool.Close())
+
+		require.Eventually(t, func() bool {
+			return rec.reached(connectivity.Shutdown) == 3
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestDialer_Clone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	addr, _ := startTestServer(t, "127.0.0.1:0")
+
+	cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&timeout=5s&headers=x-team:payments")
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	tag := func(name string) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			mu.Lock()
+			calls = append(calls, name)
+			mu.Unlock()
+
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+
+	// Appending one by one leaves spare capacity in the interceptors slice,
+	// which derived dialers must not share.
+	base := cfg.NewDialer().
+		WithUnaryInterceptors(tag("base-1")).
+		WithUnaryInterceptors(tag("base-2")).
+		WithUnaryInterceptors(tag("base-3"))
+
+	billing := base.WithUnaryInterceptors(tag("billing"))
+	orders := base.WithUnaryInterceptors(tag("orders"))
+
+	for _, tt := range []struct {
+		dialer *grpcx.Dialer
+		want   []string
+	}{
+		{dialer: base, want: []string{"base-1", "base-2", "base-3"}},
+		{dialer: billing, want: []string{"base-1", "base-2", "base-3", "billing"}},
+		{dialer: orders, want: []string{"base-1", "base-2", "base-3", "orders"}},
+	} {
+		calls = nil
+
+		conn, dErr := tt.dialer.Dial(ctx)
+		require.NoError(t, dErr)
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		mu.Lock()
+		require.Equal(t, tt.want, calls)
+		mu.Unlock()
+	}
+
+	t.Run("it should not share the config", func(t *testing.T) {
+		c := billing.Config()
+		c.Headers["x-team"] = "orders"
+		c.Port = 1
+
+		require.Equal(t, "payments", billing.Config().Headers["x-team"])
+		require.Equal(t, "payments", base.Config().Headers["x-team"])
+		require.Equal(t, cfg.Port, billing.Config().Port)
+
+		cfg.Headers["x-team"] = "orders"
+		require.Equal(t, "payments", base.Config().Headers["x-team"])
+	})
+}
+
+func TestDialer_DialPool(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	backend, _ := startTestServer(t, "127.0.0.1:0")
+
+	// gatedProxy starts a proxy that tunnels as many connections as allowed,
+	// refusing the rest.
+	gatedProxy := func(allowed *atomic.Int32) *testProxy {
+		return startTestProxy(t, backend, func(p *testProxy, conn net.Conn) bool {
+			return allowed.Add(-1) >= 0 && serveHTTPConnect(p, conn)
+		})
+	}
+
+	t.Run("it should reject invalid sizes", func(t *testing.T) {
+		cfg, err := grpcx.ParseClientConfig("grpc://" + backend + "?tls=false")
+		require.NoError(t, err)
+
+		_, err = cfg.NewDialer().DialPool(ctx, 0)
+		require.Error(t, err)
+
+		_, err = cfg.NewDialer().DialPool(ctx, 2, grpcx.WithMinReady(3))
+		require.Error(t, err)
+	})
+
+	t.Run("it should close every connection when the pool cannot be dialed", func(t *testing.T) {
+		var allowed atomic.Int32
+		allowed.Store(2)
+
+		p := gatedProxy(&allowed)
+
+		cfg, err := grpcx.ParseClientConfig("grpc://backend.internal:50051?tls=false&timeout=500ms&proxy=http://" + p.addr)
+		require.NoError(t, err)
+
+		rec := &stateRecorder{}
+
+		_, err = cfg.NewDialer().OnStateChange(rec.record).DialPool(ctx, 3)
+
+		var dialErr *grpcx.DialError
+		require.ErrorAs(t, err, &dialErr)
+
+		require.Eventually(t, func() bool {
+			return rec.reached(connectivity.Shutdown) == 3
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("it should fill missing connections in the background", func(t *testing.T) {
+		var allowed atomic.Int32
+		allowed.Store(2)
+
+		p := gatedProxy(&allowed)
+
+		cfg, err := grpcx.ParseClientConfig("grpc://backend.internal:50051?tls=false&timeout=500ms&proxy=http://" + p.addr)
+		require.NoError(t, err)
+
+		rec := &stateRecorder{}
+
+		pool, err := cfg.NewDialer().OnStateChange(rec.record).DialPool(ctx, 3, grpcx.WithMinReady(2))
+		require.NoError(t, err)
+
+		_, err = grpc_health_v1.NewHealthClient(pool).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+
+		allowed.Store(100)
+
+		require.Eventually(t, func() bool {
+			return rec.reached(connectivity.Ready) == 3
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, pool.Close())
+
+		require.Eventually(t, func() bool {
+			dialed := 0
+
+			for _, tr := range rec.all() {
+				if tr.from == connectivity.Idle {
+					dialed++
+				}
+			}
+
+			return rec.reached(connectivity.Shutdown) == dialed
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+// stateTransition is a connectivity state transition reported to a
+// StateChangeFunc.
+type stateTransition struct {
+	target   string
+	from, to connectivity.State
+}
+
+// stateRecorder records the transitions reported to its record method.
+type stateRecorder struct {
+	mu          sync.Mutex
+	transitions []stateTransition
+}
+
+func (r *stateRecorder) record(target string, from, to connectivity.State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.transitions = append(r.transitions, stateTransition{target: target, from: from, to: to})
+}
+
+func (r *stateRecorder) all() []stateTransition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]stateTransition(nil), r.transitions...)
+}
+
+// reached counts the transitions to the given state.
+func (r *stateRecorder) reached(state connectivity.State) int {
+	n := 0
+
+	for _, t := range r.all() {
+		if t.to == state {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestDialer_DialPool_AutoScaling(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	addr, _ := startTestServer(t, "127.0.0.1:0")
+
+	cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&timeout=5s")
+	require.NoError(t, err)
+
+	t.Run("it should reject invalid settings", func(t *testing.T) {
+		_, err = cfg.NewDialer().DialPool(ctx, 2, grpcx.WithAutoScaling(grpcx.AutoScaling{MaxSize: 1, StreamsPerConn: 1}))
+		require.Error(t, err)
+
+		_, err = cfg.NewDialer().DialPool(ctx, 1, grpcx.WithAutoScaling(grpcx.AutoScaling{MaxSize: 2}))
+		require.Error(t, err)
+	})
+
+	t.Run("it should grow with open streams and shrink when idle", func(t *testing.T) {
+		rec := &stateRecorder{}
+
+		pool, err := cfg.NewDialer().OnStateChange(rec.record).DialPool(ctx, 1, grpcx.WithAutoScaling(grpcx.AutoScaling{
+			MaxSize:        3,
+			StreamsPerConn: 1,
+			CoolDown:       300 * time.Millisecond,
+		}))
+		require.NoError(t, err)
+
+		defer pool.Close()
+
+		client := grpc_health_v1.NewHealthClient(pool)
+		streamCtx, stopStreams := context.WithCancel(ctx)
+
+		for i := 0; i < 3; i++ {
+			watch, wErr := client.Watch(streamCtx, &grpc_health_v1.HealthCheckRequest{})
+			require.NoError(t, wErr)
+
+			_, wErr = watch.Recv()
+			require.NoError(t, wErr)
+		}
+
+		require.Eventually(t, func() bool {
+			if _, cErr := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); cErr != nil {
+				return false
+			}
+
+			return rec.reached(connectivity.Ready) == 3
+		}, 5*time.Second, 10*time.Millisecond)
+
+		for i := 0; i < 10; i++ {
+			_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, 3, rec.reached(connectivity.Ready))
+
+		stopStreams()
+
+		require.Eventually(t, func() bool {
+			return rec.reached(connectivity.Shutdown) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	})
+}
+
+func TestDialer_DialPool_MaxConnectionAge(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	addr, _ := startTestServer(t, "127.0.0.1:0")
+
+	cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&timeout=5s&pool=2&pool.maxConnectionAge=200ms")
+	require.NoError(t, err)
+
+	rec := &stateRecorder{}
+
+	pool, err := cfg.NewDialer().OnStateChange(rec.record).DialConn(ctx)
+	require.NoError(t, err)
+
+	client := grpc_health_v1.NewHealthClient(pool)
+
+	// open counts the connections dialed by the pool that are not closed yet.
+	open := func() int {
+		dialed := 0
+
+		for _, tr := range rec.all() {
+			if tr.from == connectivity.Idle {
+				dialed++
+			}
+		}
+
+		return dialed - rec.reached(connectivity.Shutdown)
+	}
+
+	streamCtx, stopStream := context.WithCancel(ctx)
+
+	watch, err := client.Watch(streamCtx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	_, err = watch.Recv()
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		if _, cErr := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); cErr != nil {
+			return false
+		}
+
+		return rec.reached(connectivity.Shutdown) >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The connection carrying the stream is replaced but not closed until
+	// the stream finishes.
+	require.NoError(t, watch.Context().Err())
+
+	stopStream()
+
+	require.Eventually(t, func() bool {
+		return open() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, pool.Close())
+
+	require.Eventually(t, func() bool {
+		return open() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	t.Run("it should not route calls to replaced connections", func(t *testing.T) {
+		cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&timeout=5s&pool=2&pool.maxConnectionAge=20ms&pool.maxConnectionAgeJitter=10ms")
+		require.NoError(t, err)
+
+		conn, err := cfg.NewDialer().DialConn(ctx)
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		client := grpc_health_v1.NewHealthClient(conn)
+		until := time.Now().Add(500 * time.Millisecond)
+
+		errs := make(chan error, 8)
+
+		for i := 0; i < cap(errs); i++ {
+			go func() {
+				for time.Now().Before(until) {
+					if _, cErr := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); cErr != nil {
+						errs <- cErr
+
+						return
+					}
+				}
+
+				errs <- nil
+			}()
+		}
+
+		for i := 0; i < cap(errs); i++ {
+			require.NoError(t, <-errs)
+		}
+	})
+
+	t.Run("it should use a pool of a single connection when the pool size is not given", func(t *testing.T) {
+		cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&timeout=5s&pool.maxConnectionAge=30m")
+		require.NoError(t, err)
+
+		conn, err := cfg.NewDialer().DialConn(ctx)
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		require.Implements(t, (*grpcx.ClientConnPool)(nil), conn)
+	})
+}
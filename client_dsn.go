@@ -0,0 +1,354 @@
+package grpcx
+
+import (
+	"crypto/tls"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redactedValue is used in place of sensitive values when redacting a
+// connection string.
+const redactedValue = "xxxxx"
+
+// sensitiveHeaderKeywords is the list of keywords that, when found in a header
+// name, cause its value to be masked in redacted connection strings.
+var sensitiveHeaderKeywords = []string{
+	"authorization",
+	"cookie",
+	"token",
+	"secret",
+	"password",
+	"credential",
+	"apikey",
+	"api-key",
+	"api_key",
+}
+
+// DSN returns the canonical connection string representation of this config,
+// so that calling ParseClientConfig on the returned value yields an equivalent
+// ClientConfig. Only options that differ from ParseClientConfig defaults are
+// included, sorted by name.
+//
+// Note that TLS settings that cannot be expressed as connection string options,
+// such as certificates set programmatically, are not included. Root CAs are
+// only included when loaded from a file, see TLSRootCAsFile. Likewise, custom
+// PerRPCCredentials are not included.
+func (cfg ClientConfig) DSN() string {
+	return cfg.dsn(false)
+}
+
+// Redacted same as DSN, but values of sensitive headers, such as
+// `authorization` or `x-api-key`, literal TLS key passwords, auth secrets and
+// proxy passwords are masked. Use this method when logging connection details.
+func (cfg ClientConfig) Redacted() string {
+	return cfg.dsn(true)
+}
+
+// String implements the fmt.Stringer interface. It returns the redacted
+// connection string (see Redacted), so configs can be safely logged.
+func (cfg ClientConfig) String() string {
+	return cfg.Redacted()
+}
+
+func (cfg ClientConfig) dsn(redact bool) string {
+	dsn := "grpc://" + net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+
+	switch {
+	case cfg.resolverPath() != "" && cfg.Host == "" && cfg.Port == 0:
+		dsn = "grpc://"
+	case len(cfg.Addresses) > 1:
+		dsn = "grpc://" + strings.Join(cfg.Addresses, ",")
+	}
+
+	if query := cfg.options(redact).Encode(); query != "" {
+		dsn += "?" + query
+	}
+
+	return dsn
+}
+
+// options builds the set of connection string options that represent this
+// config.
+func (cfg ClientConfig) options(redact bool) url.Values {
+	q := url.Values{}
+
+	if cfg.Insecure {
+		q.Set("tls", "false")
+	}
+
+	if cfg.TLS != nil {
+		if cfg.TLS.InsecureSkipVerify {
+			q.Set("tls.skipVerify", "true")
+		}
+
+		if cfg.TLSRootCAsFile != "" {
+			q.Set("tls.rootCAs", cfg.TLSRootCAsFile)
+		}
+
+		if cfg.TLSCertFile != "" {
+			q.Set("tls.cert", cfg.TLSCertFile)
+		}
+
+		if cfg.TLSKeyFile != "" {
+			q.Set("tls.key", cfg.TLSKeyFile)
+		}
+
+		if cfg.TLSKeyPassword != "" {
+			password := cfg.TLSKeyPassword
+			if redact && strings.HasPrefix(password, secretSourcePass) {
+				password = secretSourcePass + redactedValue
+			}
+
+			q.Set("tls.keyPassword", password)
+		}
+
+		if cfg.TLS.MinVersion != 0 {
+			q.Set("tls.minVersion", tlsVersionName(cfg.TLS.MinVersion))
+		}
+
+		if cfg.TLS.MaxVersion != 0 {
+			q.Set("tls.maxVersion", tlsVersionName(cfg.TLS.MaxVersion))
+		}
+
+		if len(cfg.TLS.CipherSuites) > 0 {
+			names := make([]string, len(cfg.TLS.CipherSuites))
+			for i, id := range cfg.TLS.CipherSuites {
+				names[i] = tls.CipherSuiteName(id)
+			}
+
+			q.Set("tls.cipherSuites", strings.Join(names, ","))
+		}
+
+		if len(cfg.TLS.CurvePreferences) > 0 {
+			names := make([]string, len(cfg.TLS.CurvePreferences))
+			for i, id := range cfg.TLS.CurvePreferences {
+				names[i] = curveName(id)
+			}
+
+			q.Set("tls.curves", strings.Join(names, ","))
+		}
+
+		if cfg.TLS.ServerName != "" {
+			q.Set("tls.serverName", cfg.TLS.ServerName)
+		}
+
+		// Keep an empty TLS config across round-trips.
+		if !hasOptionPrefix(q, "tls.") {
+			q.Set("tls.skipVerify", "false")
+		}
+	}
+
+	if !cfg.Blocking {
+		q.Set("blocking", "false")
+	}
+
+	if (cfg.Blocking && cfg.Timeout != defaultClientTimeout) || (!cfg.Blocking && cfg.Timeout != 0) {
+		q.Set("timeout", cfg.Timeout.String())
+	}
+
+	if cfg.Authority != "" {
+		q.Set("authority", cfg.Authority)
+	}
+
+	if cfg.UserAgent != "" {
+		q.Set("userAgent", cfg.UserAgent)
+	}
+
+	if cfg.MaxHeaderListSize > 0 {
+		q.Set("maxHeaderListSize", strconv.FormatUint(uint64(cfg.MaxHeaderListSize), 10))
+	}
+
+	if cfg.MaxRecvMsgSize > 0 {
+		q.Set("maxRecvMsgSize", strconv.Itoa(cfg.MaxRecvMsgSize))
+	}
+
+	if cfg.MaxSendMsgSize > 0 {
+		q.Set("maxSendMsgSize", strconv.Itoa(cfg.MaxSendMsgSize))
+	}
+
+	if cfg.Compressor != "" {
+		q.Set("compressor", cfg.Compressor)
+	}
+
+	if cfg.InitialWindowSize > 0 {
+		q.Set("initialWindowSize", strconv.FormatInt(int64(cfg.InitialWindowSize), 10))
+	}
+
+	if cfg.InitialConnWindowSize > 0 {
+		q.Set("initialConnWindowSize", strconv.FormatInt(int64(cfg.InitialConnWindowSize), 10))
+	}
+
+	if cfg.ReadBufferSize > 0 {
+		q.Set("readBufferSize", strconv.Itoa(cfg.ReadBufferSize))
+	}
+
+	if cfg.WriteBufferSize > 0 {
+		q.Set("writeBufferSize", strconv.Itoa(cfg.WriteBufferSize))
+	}
+
+	if cfg.KeepAliveInterval != 0 {
+		q.Set("keepAlive.interval", cfg.KeepAliveInterval.String())
+	}
+
+	if cfg.KeepAliveTimeout != 0 {
+		q.Set("keepAlive.timeout", cfg.KeepAliveTimeout.String())
+	}
+
+	if len(cfg.Headers) > 0 {
+		keys := make([]string, 0, len(cfg.Headers))
+		for k := range cfg.Headers {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v := cfg.Headers[k]
+			if redact && v != "" && !strings.HasPrefix(v, fileValuePrefix) && isSensitiveHeader(k) {
+				v = redactedValue
+			}
+
+			q.Add("headers", k+":"+v)
+		}
+	}
+
+	if cfg.Auth != nil {
+		authOptions(q, cfg.Auth, redact)
+	}
+
+	if cfg.Proxy != nil {
+		proxy := cfg.Proxy.String()
+		if redact {
+			proxy = cfg.Proxy.Redacted()
+		}
+
+		q.Set("proxy", proxy)
+	}
+
+	if cfg.ResolverScheme != "" {
+		q.Set("resolver.scheme", cfg.ResolverScheme)
+	}
+
+	if cfg.ResolverAuthority != "" {
+		q.Set("resolver.authority", cfg.ResolverAuthority)
+	}
+
+	if path := cfg.resolverPath(); path != "" {
+		q.Set("resolver.path", path)
+	}
+
+	if cfg.DefaultServiceConfig != "" {
+		q.Set("defaultServiceConfig", cfg.DefaultServiceConfig)
+	}
+
+	if cfg.Retry != nil {
+		retryOptions(q, cfg.Retry)
+	}
+
+	if len(cfg.Methods) > 0 {
+		names := make([]string, 0, len(cfg.Methods))
+		for name := range cfg.Methods {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			mc := cfg.Methods[name]
+
+			if mc.Timeout != 0 {
+				q.Add("method.timeout", name+":"+mc.Timeout.String())
+			}
+
+			if mc.WaitForReady != nil {
+				q.Add("method.waitForReady", name+":"+strconv.FormatBool(*mc.WaitForReady))
+			}
+		}
+	}
+
+	if cfg.PoolSize > 0 {
+		q.Set("pool", strconv.Itoa(cfg.PoolSize))
+	}
+
+	if cfg.PoolStrategy != "" {
+		q.Set("pool.strategy", string(cfg.PoolStrategy))
+	}
+
+	if cfg.PoolMaxConnectionAge != 0 {
+		q.Set("pool.maxConnectionAge", cfg.PoolMaxConnectionAge.String())
+	}
+
+	if cfg.PoolMaxConnectionAgeJitter != 0 {
+		q.Set("pool.maxConnectionAgeJitter", cfg.PoolMaxConnectionAgeJitter.String())
+	}
+
+	// Literal `${` sequences must not be taken as placeholders when parsed.
+	for _, values := range q {
+		for i := range values {
+			values[i] = strings.ReplaceAll(values[i], "${", "$${")
+		}
+	}
+
+	return q
+}
+
+// retryOptions adds the options that represent the given retry policy.
+func retryOptions(q url.Values, rp *RetryPolicy) {
+	if rp.MaxAttempts != 0 {
+		q.Set("retry.maxAttempts", strconv.Itoa(rp.MaxAttempts))
+	}
+
+	if rp.InitialBackoff != 0 {
+		q.Set("retry.initialBackoff", rp.InitialBackoff.String())
+	}
+
+	if rp.MaxBackoff != 0 {
+		q.Set("retry.maxBackoff", rp.MaxBackoff.String())
+	}
+
+	if rp.BackoffMultiplier != 0 {
+		q.Set("retry.backoffMultiplier", strconv.FormatFloat(rp.BackoffMultiplier, 'f', -1, 64))
+	}
+
+	if len(rp.RetryableStatusCodes) > 0 {
+		names := make([]string, len(rp.RetryableStatusCodes))
+		for i, c := range rp.RetryableStatusCodes {
+			names[i] = statusCodeNames[c]
+		}
+
+		q.Set("retry.codes", strings.Join(names, ","))
+	}
+
+	for _, name := range rp.Names {
+		q.Add("retry.scope", name)
+	}
+}
+
+// hasOptionPrefix whether the given set of options has at least one option
+// whose name starts with the given prefix.
+func hasOptionPrefix(q url.Values, prefix string) bool {
+	for k := range q {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSensitiveHeader whether the value of the given header should be masked
+// when redacting.
+func isSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, keyword := range sensitiveHeaderKeywords {
+		if strings.Contains(name, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+package grpcx_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+)
+
+func TestClientConfig_DSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{
+			dsn:  "grpc://example.com:443",
+			want: "grpc://example.com:443",
+		},
+		{
+			dsn:  "grpc://:443?tls=true&blocking=true&timeout=10s",
+			want: "grpc://:443",
+		},
+		{
+			dsn:  "grpc://example.com:443?timeout=5s&tls=false",
+			want: "grpc://example.com:443?timeout=5s&tls=false",
+		},
+		{
+			dsn:  "grpc://example.com:443?blocking=false&tls=false",
+			want: "grpc://example.com:443?blocking=false&tls=false",
+		},
+		{
+			dsn:  "grpc://example.com:443?tls.skipVerify=false",
+			want: "grpc://example.com:443?tls.skipVerify=false",
+		},
+		{
+			dsn:  "grpc://example.com:443?headers=b:2&headers=a:1&pool=4",
+			want: "grpc://example.com:443?headers=a%3A1&headers=b%3A2&pool=4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			cfg, err := grpcx.ParseClientConfig(tt.dsn)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, cfg.DSN())
+		})
+	}
+
+	t.Run("it should honor the deprecated resolver endpoint", func(t *testing.T) {
+		cfg := grpcx.ClientConfig{Insecure: true, ResolverScheme: "unix", ResolverEndpoint: "/run/backend.sock"}
+		require.NoError(t, cfg.Validate())
+		require.Equal(t, "grpc://?blocking=false&resolver.path=%2Frun%2Fbackend.sock&resolver.scheme=unix&tls=false", cfg.DSN())
+	})
+}
+
+func TestClientConfig_DSN_RoundTrip(t *testing.T) {
+	dsns := []string{
+		"grpc://example.com:443",
+		"grpc://:8080?tls=false",
+		"grpc://[::1]:8080?tls=false&blocking=false&timeout=0s",
+		"grpc://example.com:443?tls.skipVerify=true&tls.minVersion=771&tls.maxVersion=772&tls.serverName=foo.com",
+		"grpc://example.com:443?tls.minVersion=1.2&tls.cipherSuites=TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256&tls.curves=X25519,P384",
+		"grpc://example.com:443?authority=example.com&userAgent=grpc-go/1.38.0&maxHeaderListSize=50",
+		"grpc://example.com:443?userAgent=agent-$${HOME}&headers=x-template:$${tenant}",
+		"grpc://example.com:443?keepAlive.interval=11s&keepAlive.timeout=1m30s",
+		"grpc://example.com:443?headers=foo:bar&headers=authorization:Bearer%20abc&headers=no-value:",
+		"grpc://example.com:443?resolver.scheme=dns&defaultServiceConfig=lbp-round_robin&pool=8",
+		"grpc://example.com:443?pool=4&pool.strategy=least_outstanding&pool.maxConnectionAge=30m0s&pool.maxConnectionAgeJitter=3m0s",
+		"grpc://10.0.0.1:50051,[::1]:50052?defaultServiceConfig=lbp-round_robin",
+		"grpc://example.com:443?retry.maxAttempts=4&retry.initialBackoff=50ms&retry.backoffMultiplier=1.5&retry.codes=UNAVAILABLE,ABORTED&retry.scope=pkg.Svc",
+		"grpc://example.com:443?maxRecvMsgSize=16MB&maxSendMsgSize=1KB&compressor=gzip&initialWindowSize=1MB&readBufferSize=64KB",
+		"grpc://example.com:443?method.timeout=/pkg.Svc/Get:2s&method.timeout=:1m0s&method.waitForReady=pkg.Svc:true",
+	}
+
+	for _, dsn := range dsns {
+		t.Run(dsn, func(t *testing.T) {
+			cfg, err := grpcx.ParseClientConfig(dsn)
+			require.NoError(t, err)
+
+			parsed, err := grpcx.ParseClientConfig(cfg.DSN())
+			require.NoError(t, err)
+
+			if !reflect.DeepEqual(cfg, parsed) {
+				t.Errorf("round-trip mismatch for `%s`: got = %#v, want %#v", cfg.DSN(), parsed, cfg)
+			}
+		})
+	}
+}
+
+func TestClientConfig_Redacted(t *testing.T) {
+	cfg, err := grpcx.ParseClientConfig("grpc://example.com:443?headers=authorization:Bearer%20abc123&headers=x-api-key:s3cr3t&headers=foo:bar")
+	require.NoError(t, err)
+
+	redacted := cfg.Redacted()
+
+	require.NotContains(t, redacted, "abc123")
+	require.NotContains(t, redacted, "s3cr3t")
+	require.Contains(t, redacted, "foo%3Abar")
+	require.Equal(t, redacted, cfg.String())
+	require.True(t, strings.HasPrefix(redacted, "grpc://example.com:443?"))
+
+	parsed, err := grpcx.ParseClientConfig(redacted)
+	require.NoError(t, err)
+	require.Equal(t, "xxxxx", parsed.Headers["authorization"])
+	require.Equal(t, "bar", parsed.Headers["foo"])
+}
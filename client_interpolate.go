@@ -0,0 +1,194 @@
+package grpcx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// fileValuePrefix marks option values that must be read from a file, e.g.
+// `@file:/run/secrets/token`.
+const fileValuePrefix = "@file:"
+
+// envPlaceholder matches `${NAME}` placeholders within option values, along
+// with `$${` escapes standing for a literal `${`.
+var envPlaceholder = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateOption resolves placeholders found in the given option values.
+// `${NAME}` placeholders are replaced by the value of the respective
+// environment variable, and values prefixed with `@file:` are replaced by the
+// content of the referenced file.
+//
+// File references within headers are kept as is, so they can be re-read on
+// every request (see fileHeaders); the file is only checked to be readable.
+// TLS key passwords are turned into secret sources instead (see
+// resolveSecretSource), so they are only read when loading the key.
+func interpolateOption(option string, values []string) ([]string, error) {
+	out := make([]string, len(values))
+
+	for i := range values {
+		value, expanded, err := expandEnvPlaceholders(values[i])
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case option == "headers":
+			if k, v, ok := strings.Cut(value, ":"); ok && strings.HasPrefix(strings.TrimSpace(v), fileValuePrefix) {
+				path := strings.TrimPrefix(strings.TrimSpace(v), fileValuePrefix)
+				if _, err := readFileValue(path); err != nil {
+					return nil, err
+				}
+
+				value = k + ":" + fileValuePrefix + path
+			}
+		case option == "tls.keyPassword" && strings.HasPrefix(value, fileValuePrefix):
+			value = secretSourceFile + strings.TrimPrefix(value, fileValuePrefix)
+		case option == "tls.keyPassword" && expanded && !isSecretSource(value):
+			value = secretSourcePass + value
+		case strings.HasPrefix(value, fileValuePrefix):
+			value, err = readFileValue(strings.TrimPrefix(value, fileValuePrefix))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		out[i] = value
+	}
+
+	return out, nil
+}
+
+// expandEnvPlaceholders replaces every `${NAME}` placeholder in the given
+// value, failing if the referenced environment variable is not set, and
+// unescapes `$${` into `${`. It reports whether any placeholder was replaced.
+func expandEnvPlaceholders(value string) (string, bool, error) {
+	var (
+		missing  []string
+		replaced bool
+	)
+
+	expanded := envPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		if placeholder == "$${" {
+			return "${"
+		}
+
+		name := envPlaceholder.FindStringSubmatch(placeholder)[1]
+
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+
+		replaced = true
+
+		return v
+	})
+
+	if len(missing) > 0 {
+		return "", false, fmt.Errorf("%w: environment variable `%s` is not set", ErrInvalidClientConnectionString, strings.Join(missing, "`, `"))
+	}
+
+	return expanded, replaced, nil
+}
+
+// readFileValue reads the given file, trailing line breaks are removed.
+func readFileValue(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("%w: file path cannot be empty", ErrInvalidClientConnectionString)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: could not read file `%s`, details = %w", ErrInvalidClientConnectionString, path, err)
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// fileHeaders provides the headers of a config, resolving values that
+// reference a file (`@file:` prefix). Files are re-read whenever they change,
+// so rotated secrets are picked up without re-dialing. If a file cannot be
+// read, its last known value is used.
+type fileHeaders struct {
+	static map[string]string
+	files  map[string]string
+
+	mu     sync.Mutex
+	values map[string]string
+	stamps map[string]fileStamp
+}
+
+// newFileHeaders builds a new fileHeaders for the given headers, nil is
+// returned if none of them references a file.
+func newFileHeaders(headers map[string]string) *fileHeaders {
+	h := &fileHeaders{
+		static: make(map[string]string),
+		files:  make(map[string]string),
+		values: make(map[string]string),
+		stamps: make(map[string]fileStamp),
+	}
+
+	for k, v := range headers {
+		if strings.HasPrefix(v, fileValuePrefix) {
+			h.files[k] = strings.TrimPrefix(v, fileValuePrefix)
+
+			continue
+		}
+
+		h.static[k] = v
+	}
+
+	if len(h.files) == 0 {
+		return nil
+	}
+
+	return h
+}
+
+// get returns the current set of headers, it matches the headers.HeadersFunc
+// signature.
+func (h *fileHeaders) get(_ context.Context) (map[string]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make(map[string]string, len(h.static)+len(h.files))
+	for k, v := range h.static {
+		out[k] = v
+	}
+
+	for k, path := range h.files {
+		if stamp, changed := h.changed(k, path); changed {
+			if v, err := readFileValue(path); err == nil {
+				h.values[k] = v
+				h.stamps[k] = stamp
+			}
+		}
+
+		v, ok := h.values[k]
+		if !ok {
+			return nil, fmt.Errorf("could not read header `%s` from file `%s`", k, path)
+		}
+
+		out[k] = v
+	}
+
+	return out, nil
+}
+
+// changed reports whether the file backing the given header changed since it
+// was last read.
+func (h *fileHeaders) changed(header, path string) (fileStamp, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, false
+	}
+
+	current := fileStamp{modTime: info.ModTime(), size: info.Size()}
+	last, ok := h.stamps[header]
+
+	return current, !ok || !current.modTime.Equal(last.modTime) || current.size != last.size
+}
@@ -0,0 +1,335 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// poolRedialMinDelay is the initial delay between attempts to dial pool
+	// connections in the background.
+	poolRedialMinDelay = 100 * time.Millisecond
+
+	// poolRedialMaxDelay is the maximum delay between attempts to dial pool
+	// connections in the background.
+	poolRedialMaxDelay = 30 * time.Second
+
+	// poolDrainInterval is how often connections removed from a pool are
+	// checked for in-flight calls and streams before closing them.
+	poolDrainInterval = 100 * time.Millisecond
+
+	// defaultPoolCoolDown is how long a connection must be idle before an
+	// auto-scaling pool removes it, when not given.
+	defaultPoolCoolDown = time.Minute
+)
+
+// PoolStrategy is the strategy used by pools to distribute calls among their
+// connections.
+type PoolStrategy string
+
+const (
+	// PoolStrategyRoundRobin distributes calls among connections in turns.
+	PoolStrategyRoundRobin PoolStrategy = "round_robin"
+
+	// PoolStrategyLeastOutstanding routes each call to the connection with
+	// the fewest in-flight unary calls and open streams, so connections busy
+	// with long-lived streams receive less new calls.
+	PoolStrategyLeastOutstanding PoolStrategy = "least_outstanding"
+)
+
+func (s PoolStrategy) valid() bool {
+	return s == PoolStrategyRoundRobin || s == PoolStrategyLeastOutstanding
+}
+
+// PoolOption configures a pool of connections dialed using Dialer.DialPool.
+type PoolOption func(o *poolOptions)
+
+type poolOptions struct {
+	minReady     int
+	strategy     PoolStrategy
+	autoScaling  *AutoScaling
+	maxAge       time.Duration
+	maxAgeJitter time.Duration
+}
+
+// WithMaxConnectionAge makes the pool replace each of its connections once it
+// reaches the given age, plus or minus a random duration up to the given
+// jitter, so connections are spread over new backends, e.g. behind L4 load
+// balancers. A jitter of about 10% of the age avoids replacing every
+// connection at once.
+//
+// Replacements are dialed through the same Dialer before being swapped into
+// the pool, replaced connections are closed once their in-flight calls and
+// streams finish.
+func WithMaxConnectionAge(age, jitter time.Duration) PoolOption {
+	return func(o *poolOptions) {
+		o.maxAge = age
+		o.maxAgeJitter = jitter
+	}
+}
+
+// AutoScaling configures pools that grow and shrink with their load, see
+// WithAutoScaling.
+type AutoScaling struct {
+	// MaxSize is the maximum number of connections of the pool, which must
+	// not be lower than the pool size given to Dialer.DialPool.
+	MaxSize int
+
+	// StreamsPerConn is the average number of in-flight unary calls and open
+	// streams per connection above which a connection is added to the pool.
+	// It should be kept below the MAX_CONCURRENT_STREAMS setting of the
+	// server. Must be greater than zero.
+	StreamsPerConn int
+
+	// CoolDown is how long a connection must have no in-flight calls or open
+	// streams before it is removed from the pool. Default is one minute.
+	CoolDown time.Duration
+}
+
+// WithAutoScaling makes the pool grow and shrink with its load. The pool size
+// given to Dialer.DialPool becomes the minimum size of the pool, connections
+// are added one at a time, through the same Dialer, while the load exceeds
+// the given threshold and the pool is below its maximum size. Connections idle
+// for longer than the cool-down period are removed, down to the minimum size.
+func WithAutoScaling(config AutoScaling) PoolOption {
+	return func(o *poolOptions) {
+		o.autoScaling = &config
+	}
+}
+
+// WithStrategy sets the strategy used to distribute calls among the
+// connections of the pool, PoolStrategyRoundRobin by default.
+func WithStrategy(strategy PoolStrategy) PoolOption {
+	return func(o *poolOptions) {
+		o.strategy = strategy
+	}
+}
+
+// WithMinReady makes the pool usable as soon as the given number of
+// connections are dialed, instead of waiting for all of them. Connections that
+// fail to dial are retried in the background, with exponential backoff, and
+// added to the pool as they succeed, until the pool is full or closed.
+//
+// It must be between one and the pool size, which is the default.
+func WithMinReady(n int) PoolOption {
+	return func(o *poolOptions) {
+		o.minReady = n
+	}
+}
+
+// poolOptions returns the pool options given by the config.
+func (cfg *ClientConfig) poolOptions() []PoolOption {
+	var opts []PoolOption
+
+	if cfg.PoolStrategy != "" {
+		opts = append(opts, WithStrategy(cfg.PoolStrategy))
+	}
+
+	if cfg.PoolMaxConnectionAge > 0 {
+		jitter := cfg.PoolMaxConnectionAgeJitter
+		if jitter == 0 {
+			jitter = cfg.PoolMaxConnectionAge / 10
+		}
+
+		opts = append(opts, WithMaxConnectionAge(cfg.PoolMaxConnectionAge, jitter))
+	}
+
+	return opts
+}
+
+// DialPool dials the backend using the given context and returns a ClientConn
+// implementation that uses a pool of grpc.ClientConn instances when calling "Invoke" and
+// "NewStream".
+//
+// This allows to have multiple connections to the same backend, and distribute the
+// requests between connections.
+//
+// Connections are dialed concurrently. If the pool cannot be started, every
+// connection opened so far is closed and the dial errors are returned joined.
+// See WithMinReady to start a pool before all of its connections are ready.
+//
+// Calls are routed only to READY or IDLE connections when there are any, see
+// NewClientConnPool. Connections that are shut down behind the pool's back are
+// replaced by new ones dialed in the background.
+func (d *Dialer) DialPool(ctx context.Context, poolSize int, opts ...PoolOption) (ClientConnPool, error) {
+	if poolSize <= 0 {
+		return nil, fmt.Errorf("invalid pool size %d, must be greater than zero", poolSize)
+	}
+
+	o := poolOptions{minReady: poolSize, strategy: PoolStrategyRoundRobin}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.minReady <= 0 || o.minReady > poolSize {
+		return nil, fmt.Errorf("invalid pool min ready %d, must be between 1 and the pool size %d", o.minReady, poolSize)
+	}
+
+	if !o.strategy.valid() {
+		return nil, fmt.Errorf("unknown pool strategy `%s`", o.strategy)
+	}
+
+	if o.maxAge < 0 || o.maxAgeJitter < 0 || (o.maxAge > 0 && o.maxAgeJitter >= o.maxAge) {
+		return nil, fmt.Errorf("invalid pool max connection age %s with jitter %s, cannot be negative and the jitter must be lower than the age", o.maxAge, o.maxAgeJitter)
+	}
+
+	if as := o.autoScaling; as != nil {
+		if as.MaxSize < poolSize {
+			return nil, fmt.Errorf("invalid pool auto-scaling max size %d, cannot be lower than the pool size %d", as.MaxSize, poolSize)
+		}
+
+		if as.StreamsPerConn <= 0 {
+			return nil, fmt.Errorf("invalid pool auto-scaling streams per connection %d, must be greater than zero", as.StreamsPerConn)
+		}
+
+		if as.CoolDown < 0 {
+			return nil, fmt.Errorf("invalid pool auto-scaling cool-down %s, cannot be negative", as.CoolDown)
+		}
+
+		if as.CoolDown == 0 {
+			as.CoolDown = defaultPoolCoolDown
+		}
+	}
+
+	// Connections may be dialed in the background, later changes to the
+	// dialer must not affect them.
+	d = d.Clone()
+
+	// Pending dials are canceled along with the caller's context, or once the
+	// pool is closed.
+	pool := newConnPool(d, o.strategy)
+	dialCtx, cancelDial := context.WithCancel(ctx)
+	stopAfter := context.AfterFunc(pool.ctx, cancelDial)
+
+	results := make(chan poolDialResult, poolSize)
+
+	for i := 0; i < poolSize; i++ {
+		go func() {
+			conn, err := d.Dial(dialCtx)
+			results <- poolDialResult{conn: conn, err: err}
+		}()
+	}
+
+	var (
+		conns []*grpc.ClientConn
+		errs  []error
+	)
+
+	for len(conns) < o.minReady && poolSize-len(errs) >= o.minReady {
+		if r := <-results; r.err != nil {
+			errs = append(errs, r.err)
+		} else {
+			conns = append(conns, r.conn)
+		}
+	}
+
+	pending := poolSize - len(conns) - len(errs)
+
+	if len(conns) < o.minReady {
+		_ = pool.Close()
+		cancelDial()
+
+		for i := 0; i < pending; i++ {
+			if r := <-results; r.err == nil {
+				conns = append(conns, r.conn)
+			}
+		}
+
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+
+		return nil, fmt.Errorf("could not dial connection pool, %d out of %d connections failed, details = %w", len(errs), poolSize, errors.Join(errs...))
+	}
+
+	pool.maxAge = o.maxAge
+	pool.maxAgeJitter = o.maxAgeJitter
+
+	if o.autoScaling != nil {
+		pool.autoScaling = o.autoScaling
+		pool.minSize = poolSize
+		pool.wg.Add(1)
+
+		go pool.scaleDown()
+	}
+
+	for _, conn := range conns {
+		pool.add(conn)
+	}
+
+	if missing := len(errs); pending > 0 || missing > 0 {
+		pool.wg.Add(1)
+
+		go func() {
+			defer pool.wg.Done()
+			defer cancelDial()
+			defer stopAfter()
+
+			fillPool(pool, results, pending, missing)
+		}()
+	} else {
+		stopAfter()
+		cancelDial()
+	}
+
+	return pool, nil
+}
+
+// poolDialResult is the outcome of dialing a pool connection.
+type poolDialResult struct {
+	conn *grpc.ClientConn
+	err  error
+}
+
+// fillPool adds the connections still being dialed to the given pool, then
+// dials the missing ones until the pool is full or closed.
+func fillPool(pool *connPool, results <-chan poolDialResult, pending, missing int) {
+	for i := 0; i < pending; i++ {
+		r := <-results
+
+		switch {
+		case r.err != nil:
+			missing++
+		case !pool.add(r.conn):
+			_ = r.conn.Close()
+		}
+	}
+
+	for ; missing > 0; missing-- {
+		conn, ok := redial(pool.ctx, pool.dialer)
+		if !ok {
+			return
+		}
+
+		if !pool.add(conn) {
+			_ = conn.Close()
+
+			return
+		}
+	}
+}
+
+// redial dials a new connection using the given dialer, retrying with
+// exponential backoff until it succeeds or the context is done.
+func redial(ctx context.Context, d *Dialer) (*grpc.ClientConn, bool) {
+	delay := poolRedialMinDelay
+
+	for {
+		conn, err := d.Dial(ctx)
+		if err == nil {
+			return conn, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(delay):
+		}
+
+		delay = min(2*delay, poolRedialMaxDelay)
+	}
+}
@@ -0,0 +1,184 @@
+package grpcx
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// defaultProxyPorts ports used when a proxy URL does not specify one, keyed
+// by scheme.
+var defaultProxyPorts = map[string]string{
+	"http":    "80",
+	"https":   "443",
+	"socks5":  "1080",
+	"socks5h": "1080",
+}
+
+// validateProxyURL checks that the given URL can be used as a proxy.
+func validateProxyURL(u *url.URL) error {
+	if _, ok := defaultProxyPorts[u.Scheme]; !ok {
+		return fmt.Errorf("unsupported proxy scheme `%s`, expecting `http`, `https`, `socks5` or `socks5h`", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("proxy host cannot be empty")
+	}
+
+	return nil
+}
+
+// contextDialer returns the dialer used by connections. When a proxy is given,
+// connections are tunneled through it, using HTTP CONNECT for `http` and
+// `https` proxies and SOCKS5 for `socks5` and `socks5h` proxies, and addresses
+// matching the NO_PROXY (or no_proxy) environment variable are dialed
+// directly.
+//
+// Otherwise addresses are dialed directly, unless a proxy is configured
+// through the HTTPS_PROXY (or https_proxy) environment variable. In that case
+// nil is returned, so gRPC's own dialer is used, as it honors the variable
+// along with grpc.WithNoProxy.
+func contextDialer(proxyURL *url.URL) func(ctx context.Context, addr string) (net.Conn, error) {
+	if proxyURL == nil {
+		if httpproxy.FromEnvironment().HTTPSProxy != "" {
+			return nil
+		}
+
+		return dialDirect
+	}
+
+	env := &httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    httpproxy.FromEnvironment().NoProxy,
+	}
+
+	proxyFunc := env.ProxyFunc()
+
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		if u, err := proxyFunc(&url.URL{Scheme: "https", Host: addr}); err != nil || u == nil || strings.HasPrefix(addr, "unix:") {
+			return dialDirect(ctx, addr)
+		}
+
+		if proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h" {
+			var direct net.Dialer
+
+			d, err := proxy.FromURL(proxyURL, &direct)
+			if err != nil {
+				return nil, err
+			}
+
+			return d.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+		}
+
+		return dialHTTPConnect(ctx, proxyURL, addr)
+	}
+}
+
+// dialDirect dials the given address without any proxy. gRPC passes unix
+// socket addresses to custom dialers in the form `unix://absolute-path` or
+// `unix:relative-path`.
+func dialDirect(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+
+	if strings.HasPrefix(addr, "unix:") {
+		return d.DialContext(ctx, "unix", strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//"))
+	}
+
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// dialHTTPConnect opens a tunnel to the given address through an HTTP proxy
+// using the CONNECT method.
+func dialHTTPConnect(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	port := proxyURL.Port()
+	if port == "" {
+		port = defaultProxyPorts[proxyURL.Scheme]
+	}
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(proxyURL.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("could not dial proxy `%s`, details = %w", proxyURL.Redacted(), err)
+	}
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+
+			return nil, fmt.Errorf("could not establish tls with proxy `%s`, details = %w", proxyURL.Redacted(), err)
+		}
+
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("could not write CONNECT request to proxy `%s`, details = %w", proxyURL.Redacted(), err)
+	}
+
+	r := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("could not read CONNECT response from proxy `%s`, details = %w", proxyURL.Redacted(), err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("proxy `%s` refused to connect to `%s`, status = %s", proxyURL.Redacted(), addr, resp.Status)
+	}
+
+	if r.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: r}, nil
+	}
+
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads are served from a buffered reader,
+// so data received along with the proxy response is not lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
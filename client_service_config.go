@@ -0,0 +1,429 @@
+package grpcx
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Default values used for unset RetryPolicy fields.
+const (
+	defaultRetryMaxAttempts       = 3
+	defaultRetryInitialBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff        = time.Second
+	defaultRetryBackoffMultiplier = 2.0
+)
+
+// statusCodeNames canonical names of gRPC status codes, as expected by
+// service configs.
+var statusCodeNames = map[codes.Code]string{
+	codes.OK:                 "OK",
+	codes.Canceled:           "CANCELLED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
+
+// RetryPolicy describes how failed calls are retried by the gRPC client. It
+// is compiled into the `retryPolicy` of a service config method config, see
+// ClientConfig.ServiceConfig.
+//
+// For more information about retry policies, see:
+// https://github.com/grpc/proposal/blob/master/A6-client-retries.md
+type RetryPolicy struct {
+	// Names list of fully qualified services (e.g. `pkg.Service`) or methods
+	// (e.g. `pkg.Service/Method`) this policy applies to. If empty, the
+	// policy applies to every method.
+	Names []string
+
+	// MaxAttempts maximum number of attempts, including the original call.
+	// Must be greater than one. Default is 3.
+	MaxAttempts int
+
+	// InitialBackoff delay before the first retry. Default is 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff upper bound for the delay between retries. Default is 1s.
+	MaxBackoff time.Duration
+
+	// BackoffMultiplier factor applied to the delay after each retry. Default
+	// is 2.
+	BackoffMultiplier float64
+
+	// RetryableStatusCodes list of status codes that trigger a retry. Default
+	// is UNAVAILABLE.
+	RetryableStatusCodes []codes.Code
+}
+
+// MethodConfig default settings for calls to a service or method. It is
+// compiled into a service config method config, see
+// ClientConfig.ServiceConfig.
+type MethodConfig struct {
+	// Timeout default timeout for calls. The effective deadline of a call is
+	// the shortest between this value and the one carried by its context. Zero
+	// means no default timeout.
+	Timeout time.Duration
+
+	// WaitForReady default wait-for-ready behavior for calls, see
+	// grpc.WaitForReady. Nil means gRPC's default, which is to fail fast.
+	WaitForReady *bool
+}
+
+// methodSetting a single method config field to be applied to the given list
+// of service or method names.
+type methodSetting struct {
+	names []string
+	key   string
+	value interface{}
+}
+
+// ServiceConfig returns the JSON service config to be used when dialing, that
+// is DefaultServiceConfig merged with the method configs compiled from Retry
+// and Methods.
+//
+// Compiled settings are merged into the `methodConfig` entry with the same
+// name if present, unless such entry already defines them, otherwise a new
+// entry is appended.
+func (cfg ClientConfig) ServiceConfig() (string, error) {
+	settings, err := cfg.methodSettings()
+	if err != nil {
+		return "", err
+	}
+
+	if len(settings) == 0 {
+		return cfg.DefaultServiceConfig, nil
+	}
+
+	sc := make(map[string]interface{})
+	if cfg.DefaultServiceConfig != "" {
+		if uErr := json.Unmarshal([]byte(cfg.DefaultServiceConfig), &sc); uErr != nil {
+			return "", fmt.Errorf("invalid default service config, details = %w", uErr)
+		}
+	}
+
+	entries, err := methodConfigEntries(sc)
+	if err != nil {
+		return "", err
+	}
+
+	var generated []map[string]interface{}
+
+	for _, s := range settings {
+		names := s.names
+		if len(names) == 0 {
+			names = []string{""}
+		}
+
+		for _, name := range names {
+			service, method, pErr := parseMethodName(name)
+			if pErr != nil {
+				return "", pErr
+			}
+
+			entry := findMethodConfig(entries, service, method)
+			if entry == nil {
+				entry = map[string]interface{}{"name": []interface{}{methodNameJSON(service, method)}}
+				entries = append(entries, entry)
+				generated = append(generated, entry)
+			}
+
+			if _, ok := entry[s.key]; !ok {
+				entry[s.key] = s.value
+			}
+		}
+	}
+
+	inheritMethodConfigs(entries, generated)
+
+	list := make([]interface{}, len(entries))
+	for i := range entries {
+		list[i] = entries[i]
+	}
+
+	sc["methodConfig"] = list
+
+	out, err := json.Marshal(sc)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// methodSettings compiles the list of method config settings defined by this
+// config.
+func (cfg ClientConfig) methodSettings() ([]methodSetting, error) {
+	var settings []methodSetting
+
+	if cfg.Retry != nil {
+		policy, err := cfg.Retry.compile()
+		if err != nil {
+			return nil, err
+		}
+
+		settings = append(settings, methodSetting{names: cfg.Retry.Names, key: "retryPolicy", value: policy})
+	}
+
+	names := make([]string, 0, len(cfg.Methods))
+	for name := range cfg.Methods {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		mc := cfg.Methods[name]
+
+		if mc.Timeout < 0 {
+			return nil, fmt.Errorf("timeout for `%s` must be positive, got `%s`", name, mc.Timeout)
+		}
+
+		if mc.Timeout > 0 {
+			settings = append(settings, methodSetting{names: []string{name}, key: "timeout", value: formatJSONDuration(mc.Timeout)})
+		}
+
+		if mc.WaitForReady != nil {
+			settings = append(settings, methodSetting{names: []string{name}, key: "waitForReady", value: *mc.WaitForReady})
+		}
+	}
+
+	return settings, nil
+}
+
+// compile builds the service config representation of the policy.
+func (rp *RetryPolicy) compile() (map[string]interface{}, error) {
+	maxAttempts := rp.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+
+	initialBackoff := rp.InitialBackoff
+	if initialBackoff == 0 {
+		initialBackoff = defaultRetryInitialBackoff
+	}
+
+	maxBackoff := rp.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	multiplier := rp.BackoffMultiplier
+	if multiplier == 0 {
+		multiplier = defaultRetryBackoffMultiplier
+	}
+
+	retryableCodes := rp.RetryableStatusCodes
+	if len(retryableCodes) == 0 {
+		retryableCodes = []codes.Code{codes.Unavailable}
+	}
+
+	switch {
+	case maxAttempts < 2:
+		return nil, fmt.Errorf("retry max attempts must be greater than one, got `%d`", maxAttempts)
+	case initialBackoff < 0 || maxBackoff < 0:
+		return nil, fmt.Errorf("retry backoffs must be positive")
+	case maxBackoff < initialBackoff:
+		return nil, fmt.Errorf("retry max backoff `%s` is lower than initial backoff `%s`", maxBackoff, initialBackoff)
+	case multiplier <= 0:
+		return nil, fmt.Errorf("retry backoff multiplier must be positive, got `%v`", multiplier)
+	}
+
+	names := make([]interface{}, 0, len(retryableCodes))
+
+	for _, c := range retryableCodes {
+		name, ok := statusCodeNames[c]
+		if !ok || c == codes.OK {
+			return nil, fmt.Errorf("invalid retryable status code `%d`", c)
+		}
+
+		names = append(names, name)
+	}
+
+	return map[string]interface{}{
+		"maxAttempts":          maxAttempts,
+		"initialBackoff":       formatJSONDuration(initialBackoff),
+		"maxBackoff":           formatJSONDuration(maxBackoff),
+		"backoffMultiplier":    multiplier,
+		"retryableStatusCodes": names,
+	}, nil
+}
+
+// methodConfigEntries extracts the list of `methodConfig` entries of the given
+// service config.
+func methodConfigEntries(sc map[string]interface{}) ([]map[string]interface{}, error) {
+	raw, ok := sc["methodConfig"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid default service config, methodConfig must be a list")
+	}
+
+	entries := make([]map[string]interface{}, len(list))
+
+	for i := range list {
+		entry, isMap := list[i].(map[string]interface{})
+		if !isMap {
+			return nil, fmt.Errorf("invalid default service config, methodConfig entries must be objects")
+		}
+
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
+
+// findMethodConfig returns the entry that holds the given name, if any.
+func findMethodConfig(entries []map[string]interface{}, service, method string) map[string]interface{} {
+	for _, entry := range entries {
+		names, _ := entry["name"].([]interface{})
+
+		for _, n := range names {
+			name, _ := n.(map[string]interface{})
+			s, _ := name["service"].(string)
+			m, _ := name["method"].(string)
+
+			if s == service && m == method {
+				return entry
+			}
+		}
+	}
+
+	return nil
+}
+
+// inheritMethodConfigs completes the given generated entries with the
+// settings of less specific entries. As gRPC only applies the most specific
+// method config matching a call, a method level entry would otherwise drop
+// settings defined at service or global level.
+func inheritMethodConfigs(entries, generated []map[string]interface{}) {
+	name := func(entry map[string]interface{}) (service, method string) {
+		names, _ := entry["name"].([]interface{})
+		first, _ := names[0].(map[string]interface{})
+		service, _ = first["service"].(string)
+		method, _ = first["method"].(string)
+
+		return service, method
+	}
+
+	rank := func(entry map[string]interface{}) int {
+		service, method := name(entry)
+
+		switch {
+		case method != "":
+			return 2
+		case service != "":
+			return 1
+		}
+
+		return 0
+	}
+
+	sort.SliceStable(generated, func(i, j int) bool {
+		return rank(generated[i]) < rank(generated[j])
+	})
+
+	for _, entry := range generated {
+		service, method := name(entry)
+
+		var parents []map[string]interface{}
+
+		if method != "" {
+			parents = append(parents, findMethodConfig(entries, service, ""))
+		}
+
+		if service != "" {
+			parents = append(parents, findMethodConfig(entries, "", ""))
+		}
+
+		for _, parent := range parents {
+			if parent == nil {
+				continue
+			}
+
+			for k, v := range parent {
+				if _, ok := entry[k]; !ok {
+					entry[k] = v
+				}
+			}
+		}
+	}
+}
+
+// parseMethodName parses a fully qualified service or method name, in the
+// form `pkg.Service` or `pkg.Service/Method`, a leading slash is accepted. An
+// empty name matches every method.
+func parseMethodName(name string) (service, method string, err error) {
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	if len(parts) > 2 || (name != "" && parts[0] == "") || (len(parts) == 2 && parts[1] == "") {
+		return "", "", fmt.Errorf("invalid method name `%s`, expecting `pkg.Service` or `pkg.Service/Method`", name)
+	}
+
+	if len(parts) == 2 {
+		return parts[0], parts[1], nil
+	}
+
+	return parts[0], "", nil
+}
+
+// methodNameJSON builds the service config representation of a method name.
+func methodNameJSON(service, method string) map[string]interface{} {
+	name := make(map[string]interface{})
+
+	if service != "" {
+		name["service"] = service
+	}
+
+	if method != "" {
+		name["method"] = method
+	}
+
+	return name
+}
+
+// formatJSONDuration formats the given duration as expected by service
+// configs, e.g. `1.5s`.
+func formatJSONDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// parseStatusCode parses a status code given by its canonical name (e.g.
+// `RESOURCE_EXHAUSTED`), its Go name (e.g. `ResourceExhausted`) or its number.
+func parseStatusCode(s string) (codes.Code, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		if _, ok := statusCodeNames[codes.Code(n)]; ok {
+			return codes.Code(n), nil
+		}
+	}
+
+	normalize := func(v string) string {
+		return strings.ToLower(strings.ReplaceAll(v, "_", ""))
+	}
+
+	for c, name := range statusCodeNames {
+		if normalize(s) == normalize(name) || normalize(s) == normalize(c.String()) {
+			return c, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown status code `%s`", s)
+}
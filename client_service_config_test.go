@@ -0,0 +1,219 @@
+package grpcx_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseClientConfig_Retry(t *testing.T) {
+	cfg, err := grpcx.ParseClientConfig("grpc://example.com:443?retry.maxAttempts=4&retry.initialBackoff=50ms&retry.maxBackoff=2s&retry.backoffMultiplier=1.5&retry.codes=UNAVAILABLE,ResourceExhausted&retry.codes=10&retry.scope=/pkg.Svc/Get&retry.scope=pkg.Other")
+	require.NoError(t, err)
+
+	require.Equal(t, &grpcx.RetryPolicy{
+		Names:                []string{"/pkg.Svc/Get", "pkg.Other"},
+		MaxAttempts:          4,
+		InitialBackoff:       50 * time.Millisecond,
+		MaxBackoff:           2 * time.Second,
+		BackoffMultiplier:    1.5,
+		RetryableStatusCodes: []codes.Code{codes.Unavailable, codes.ResourceExhausted, codes.Aborted},
+	}, cfg.Retry)
+
+	sc, err := cfg.ServiceConfig()
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"methodConfig": [
+			{
+				"name": [{"service": "pkg.Svc", "method": "Get"}],
+				"retryPolicy": {
+					"maxAttempts": 4,
+					"initialBackoff": "0.05s",
+					"maxBackoff": "2s",
+					"backoffMultiplier": 1.5,
+					"retryableStatusCodes": ["UNAVAILABLE", "RESOURCE_EXHAUSTED", "ABORTED"]
+				}
+			},
+			{
+				"name": [{"service": "pkg.Other"}],
+				"retryPolicy": {
+					"maxAttempts": 4,
+					"initialBackoff": "0.05s",
+					"maxBackoff": "2s",
+					"backoffMultiplier": 1.5,
+					"retryableStatusCodes": ["UNAVAILABLE", "RESOURCE_EXHAUSTED", "ABORTED"]
+				}
+			}
+		]
+	}`, sc)
+
+	invalid := []string{
+		"grpc://example.com:443?retry.maxAttempts=1",
+		"grpc://example.com:443?retry.maxAttempts=x",
+		"grpc://example.com:443?retry.initialBackoff=-1s",
+		"grpc://example.com:443?retry.initialBackoff=2s&retry.maxBackoff=1s",
+		"grpc://example.com:443?retry.backoffMultiplier=0",
+		"grpc://example.com:443?retry.codes=OK",
+		"grpc://example.com:443?retry.codes=NOPE",
+		"grpc://example.com:443?retry.scope=pkg.Svc/Get/More",
+		"grpc://example.com:443?retry.maxAttempts=3&defaultServiceConfig={\"methodConfig\":{}}",
+	}
+
+	for _, dsn := range invalid {
+		_, pErr := grpcx.ParseClientConfig(dsn)
+		require.ErrorIs(t, pErr, grpcx.ErrInvalidClientConnectionString, dsn)
+	}
+}
+
+func TestClientConfig_ServiceConfig(t *testing.T) {
+	t.Run("it should return the default service config when no retry policy is given", func(t *testing.T) {
+		cfg := grpcx.ClientConfig{DefaultServiceConfig: `{"loadBalancingPolicy":"round_robin"}`}
+
+		sc, err := cfg.ServiceConfig()
+		require.NoError(t, err)
+		require.Equal(t, cfg.DefaultServiceConfig, sc)
+	})
+
+	t.Run("it should apply defaults and merge with the default service config", func(t *testing.T) {
+		cfg := grpcx.ClientConfig{
+			DefaultServiceConfig: `{"loadBalancingPolicy":"round_robin","methodConfig":[{"name":[{}],"timeout":"1s"},{"name":[{"service":"pkg.Svc"}],"retryPolicy":{"maxAttempts":5}}]}`,
+			Retry:                &grpcx.RetryPolicy{Names: []string{"", "pkg.Svc", "pkg.Svc/Get"}},
+		}
+
+		sc, err := cfg.ServiceConfig()
+		require.NoError(t, err)
+		require.JSONEq(t, `{
+			"loadBalancingPolicy": "round_robin",
+			"methodConfig": [
+				{
+					"name": [{}],
+					"timeout": "1s",
+					"retryPolicy": {
+						"maxAttempts": 3,
+						"initialBackoff": "0.1s",
+						"maxBackoff": "1s",
+						"backoffMultiplier": 2,
+						"retryableStatusCodes": ["UNAVAILABLE"]
+					}
+				},
+				{
+					"name": [{"service": "pkg.Svc"}],
+					"retryPolicy": {"maxAttempts": 5}
+				},
+				{
+					"name": [{"service": "pkg.Svc", "method": "Get"}],
+					"timeout": "1s",
+					"retryPolicy": {
+						"maxAttempts": 3,
+						"initialBackoff": "0.1s",
+						"maxBackoff": "1s",
+						"backoffMultiplier": 2,
+						"retryableStatusCodes": ["UNAVAILABLE"]
+					}
+				}
+			]
+		}`, sc)
+	})
+}
+
+func TestParseClientConfig_Methods(t *testing.T) {
+	cfg, err := grpcx.ParseClientConfig("grpc://example.com:443?method.timeout=/pkg.Svc/Get:2s&method.timeout=pkg.Svc:5s&method.waitForReady=pkg.Svc:true&method.timeout=:30s")
+	require.NoError(t, err)
+
+	enabled := true
+
+	require.Equal(t, map[string]grpcx.MethodConfig{
+		"/pkg.Svc/Get": {Timeout: 2 * time.Second},
+		"pkg.Svc":      {Timeout: 5 * time.Second, WaitForReady: &enabled},
+		"":             {Timeout: 30 * time.Second},
+	}, cfg.Methods)
+
+	sc, err := cfg.ServiceConfig()
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"methodConfig": [
+			{"name": [{}], "timeout": "30s"},
+			{"name": [{"service": "pkg.Svc", "method": "Get"}], "timeout": "2s", "waitForReady": true},
+			{"name": [{"service": "pkg.Svc"}], "timeout": "5s", "waitForReady": true}
+		]
+	}`, sc)
+
+	invalid := []string{
+		"grpc://example.com:443?method.timeout=pkg.Svc",
+		"grpc://example.com:443?method.timeout=pkg.Svc:nope",
+		"grpc://example.com:443?method.timeout=pkg.Svc:-1s",
+		"grpc://example.com:443?method.timeout=a/b/c:1s",
+		"grpc://example.com:443?method.waitForReady=pkg.Svc:maybe",
+	}
+
+	for _, dsn := range invalid {
+		_, pErr := grpcx.ParseClientConfig(dsn)
+		require.ErrorIs(t, pErr, grpcx.ErrInvalidClientConnectionString, dsn)
+	}
+}
+
+func TestParseClientConfigDial_MethodTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	addr, _ := startTestServer(t, "127.0.0.1:0", grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+			}
+
+			return handler(ctx, req)
+		},
+	))
+
+	dsn := fmt.Sprintf("grpc://%s?tls=false&method.timeout=/grpc.health.v1.Health/Check:100ms", addr)
+
+	conn, err := grpcx.ParseClientConfigDial(ctx, dsn)
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	start := time.Now()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestParseClientConfigDial_Retry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var calls atomic.Int32
+
+	addr, _ := startTestServer(t, "127.0.0.1:0", grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if calls.Add(1) < 3 {
+				return nil, status.Error(codes.Unavailable, "try again")
+			}
+
+			return handler(ctx, req)
+		},
+	))
+
+	dsn := fmt.Sprintf("grpc://%s?tls=false&retry.maxAttempts=3&retry.initialBackoff=10ms&retry.scope=grpc.health.v1.Health", addr)
+
+	conn, err := grpcx.ParseClientConfigDial(ctx, dsn)
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.EqualValues(t, 3, calls.Load())
+}
@@ -0,0 +1,320 @@
+package grpcx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tupleClientOptions are options whose values are `key:value` tuples. In
+// structured configs they can be given as an object instead of a list, e.g.
+// `headers: {x-tenant: acme}`.
+var tupleClientOptions = map[string]bool{
+	"headers":             true,
+	"method.timeout":      true,
+	"method.waitForReady": true,
+}
+
+// listClientOptions are options that can be repeated. When read from
+// environment variables their values are given as a comma separated list.
+var listClientOptions = map[string]bool{
+	"addresses":           true,
+	"headers":             true,
+	"retry.scope":         true,
+	"method.timeout":      true,
+	"method.waitForReady": true,
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Keys mirror the
+// connection string option names (see ParseClientConfig), plus `host`, `port`
+// and `addresses`. Dotted options can also be given as nested objects, so
+// the following documents are equivalent:
+//
+//	{"host": "example.com", "port": 443, "tls.rootCAs": "/etc/ca.pem"}
+//	{"host": "example.com", "port": 443, "tls": {"rootCAs": "/etc/ca.pem"}}
+//
+// Repeatable options are given as lists, and tuple options (headers,
+// method.timeout and method.waitForReady) as objects. Values are parsed and
+// validated exactly as connection string options are.
+func (cfg *ClientConfig) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("%w: invalid json config, details = %w", ErrInvalidClientConnectionString, err)
+	}
+
+	return cfg.unmarshalOptions(raw)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface. See UnmarshalJSON
+// for the accepted keys.
+func (cfg *ClientConfig) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]interface{}
+
+	if err := value.Decode(&raw); err != nil {
+		return fmt.Errorf("%w: invalid yaml config, details = %w", ErrInvalidClientConnectionString, err)
+	}
+
+	return cfg.unmarshalOptions(raw)
+}
+
+func (cfg *ClientConfig) unmarshalOptions(raw map[string]interface{}) error {
+	q := url.Values{}
+
+	if err := flattenClientOptions("", raw, q); err != nil {
+		return err
+	}
+
+	config, err := clientConfigFromOptions(q)
+	if err != nil {
+		return err
+	}
+
+	*cfg = config
+
+	return nil
+}
+
+// ClientConfigFromEnv builds a ClientConfig from environment variables. Each
+// connection string option (see ParseClientConfig) is read from a variable
+// named after the option, upper-cased with dots replaced by underscores and
+// prefixed with the given prefix. For instance, using the `BILLING_GRPC`
+// prefix:
+//
+//	BILLING_GRPC_HOST=billing.internal
+//	BILLING_GRPC_PORT=443
+//	BILLING_GRPC_TLS_ROOTCAS=/etc/billing/ca.pem
+//	BILLING_GRPC_KEEPALIVE_INTERVAL=30s
+//
+// Multiple addresses may be given using BILLING_GRPC_ADDRESSES instead of
+// host and port. Repeatable options, such as headers or retry.scope, are
+// given as a comma separated list. Lists of `key:value` tuples are only split
+// at commas followed by another `key:`, so values may hold commas, e.g.
+// `accept:a, b,x-tenant:acme`. Values are parsed and validated exactly as
+// connection string options are.
+func ClientConfigFromEnv(prefix string) (ClientConfig, error) {
+	names := []string{"host", "port", "addresses"}
+	for name := range clientOptionsParsers {
+		names = append(names, name)
+	}
+
+	q := url.Values{}
+
+	for _, name := range names {
+		value, ok := os.LookupEnv(clientOptionEnvName(prefix, name))
+		if !ok {
+			continue
+		}
+
+		if !listClientOptions[name] {
+			q.Add(name, value)
+
+			continue
+		}
+
+		values := strings.Split(value, ",")
+		if tupleClientOptions[name] {
+			values = splitTuples(value)
+		}
+
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v != "" {
+				q.Add(name, v)
+			}
+		}
+	}
+
+	return clientConfigFromOptions(q)
+}
+
+// splitTuples splits a comma separated list of `key:value` tuples whose
+// values may hold commas, splitting only at commas followed by a `key:`.
+func splitTuples(s string) []string {
+	var tuples []string
+
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != ',' {
+			continue
+		}
+
+		key, _, found := strings.Cut(strings.TrimLeft(s[i+1:], " "), ":")
+		if found && key != "" && !strings.ContainsAny(key, ", \t") {
+			tuples = append(tuples, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(tuples, s[start:])
+}
+
+// clientOptionEnvName returns the name of the environment variable holding the
+// given option, e.g. `tls.rootCAs` becomes `PREFIX_TLS_ROOTCAS`.
+func clientOptionEnvName(prefix, option string) string {
+	name := strings.ToUpper(strings.ReplaceAll(option, ".", "_"))
+
+	if prefix = strings.TrimSuffix(prefix, "_"); prefix != "" {
+		name = prefix + "_" + name
+	}
+
+	return name
+}
+
+// clientConfigFromOptions builds a ClientConfig from the given set of
+// options, which besides connection string options may hold the `host`,
+// `port` and `addresses` keys.
+func clientConfigFromOptions(q url.Values) (ClientConfig, error) {
+	config := newDefaultClientConfig()
+
+	var errs []error
+
+	for _, address := range q["addresses"] {
+		for _, a := range strings.Split(address, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				config.Addresses = append(config.Addresses, a)
+			}
+		}
+	}
+
+	host, port := q.Get("host"), q.Get("port")
+
+	if len(config.Addresses) > 0 {
+		h, p, err := net.SplitHostPort(config.Addresses[0])
+		if err != nil {
+			errs = append(errs, &ClientOptionError{Option: "address", Value: config.Addresses[0], Reason: "address must be in the form host:port", Err: err})
+		}
+
+		if !q.Has("host") {
+			host = h
+		}
+
+		if !q.Has("port") {
+			port = p
+		}
+	}
+
+	if len(config.Addresses) == 1 {
+		config.Addresses = nil
+	}
+
+	hasPath := q.Has("resolver.path") || q.Has("resolver.endpoint")
+
+	// As in connection strings, the host may be omitted as long as a port or a
+	// resolver path is given.
+	missing := host == "" && port == "" && !hasPath
+	if missing {
+		errs = append(errs, &ClientOptionError{Option: "host", Reason: "host cannot be empty"})
+	}
+
+	config.Host = host
+
+	p, err := strconv.Atoi(port)
+
+	switch {
+	case port == "" && (hasPath || missing):
+		p = 0
+	case port == "":
+		errs = append(errs, &ClientOptionError{Option: "port", Reason: "port cannot be empty"})
+	case err != nil:
+		errs = append(errs, &ClientOptionError{Option: "port", Value: port, Reason: "port is not a number", Err: err})
+	}
+
+	config.Port = p
+
+	for _, k := range []string{"host", "port", "addresses"} {
+		q.Del(k)
+	}
+
+	if err := config.applyOptions(q); err != nil {
+		errs = append(errs, splitJoinedError(err)...)
+	}
+
+	if len(errs) > 0 {
+		return ClientConfig{}, errors.Join(errs...)
+	}
+
+	return *config, nil
+}
+
+// flattenClientOptions converts a structured config into a set of connection
+// string options, joining the keys of nested objects with dots.
+func flattenClientOptions(prefix string, raw map[string]interface{}, q url.Values) error {
+	for key, value := range raw {
+		name := prefix + key
+
+		switch v := value.(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			if !tupleClientOptions[name] {
+				if err := flattenClientOptions(name+".", v, q); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				s, err := clientOptionValue(name, v[k])
+				if err != nil {
+					return err
+				}
+
+				q.Add(name, k+":"+s)
+			}
+		case []interface{}:
+			for _, item := range v {
+				s, err := clientOptionValue(name, item)
+				if err != nil {
+					return err
+				}
+
+				q.Add(name, s)
+			}
+		default:
+			s, err := clientOptionValue(name, v)
+			if err != nil {
+				return err
+			}
+
+			q.Add(name, s)
+		}
+	}
+
+	return nil
+}
+
+// clientOptionValue returns the string representation of a scalar value found
+// in a structured config.
+func clientOptionValue(name string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number, bool, int, int64, uint64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", &ClientOptionError{Option: name, Value: fmt.Sprint(v), Reason: fmt.Sprintf("unsupported value type %T", v)}
+	}
+}
@@ -0,0 +1,171 @@
+package grpcx_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+	"gopkg.in/yaml.v3"
+)
+
+func TestClientConfig_UnmarshalJSON(t *testing.T) {
+	expected, err := grpcx.ParseClientConfig("grpc://example.com:8080?tls=false&keepAlive.interval=30s&headers=x-tenant:acme&retry.codes=UNAVAILABLE,ABORTED&pool=2")
+	require.NoError(t, err)
+
+	t.Run("it should accept flat option names", func(t *testing.T) {
+		var cfg grpcx.ClientConfig
+
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"host": "example.com",
+			"port": 8080,
+			"tls": false,
+			"keepAlive.interval": "30s",
+			"headers": ["x-tenant:acme"],
+			"retry.codes": ["UNAVAILABLE", "ABORTED"],
+			"pool": 2
+		}`), &cfg))
+		require.Equal(t, expected, cfg)
+	})
+
+	t.Run("it should accept nested options", func(t *testing.T) {
+		var cfg grpcx.ClientConfig
+
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"host": "example.com",
+			"port": 8080,
+			"tls": false,
+			"keepAlive": {"interval": "30s"},
+			"headers": {"x-tenant": "acme"},
+			"retry": {"codes": "UNAVAILABLE,ABORTED"},
+			"pool": 2
+		}`), &cfg))
+		require.Equal(t, expected, cfg)
+	})
+
+	t.Run("it should report every invalid option", func(t *testing.T) {
+		var cfg grpcx.ClientConfig
+
+		err := json.Unmarshal([]byte(`{"tls": false, "timeout": "xxx", "unknown": 1}`), &cfg)
+		require.ErrorIs(t, err, grpcx.ErrInvalidClientConnectionString)
+		require.ElementsMatch(t, []string{"host", "timeout", "unknown"}, optionErrorNames(err))
+	})
+}
+
+func TestClientConfig_UnmarshalYAML(t *testing.T) {
+	var doc struct {
+		Billing grpcx.ClientConfig `yaml:"billing"`
+	}
+
+	require.NoError(t, yaml.Unmarshal([]byte(`
+billing:
+  addresses:
+    - 10.0.0.1:50051
+    - 10.0.0.2:50051
+  tls: false
+  blocking: false
+  method:
+    timeout:
+      /pkg.Service/Get: 2s
+`), &doc))
+
+	cfg := doc.Billing
+	require.Equal(t, "10.0.0.1", cfg.Host)
+	require.Equal(t, 50051, cfg.Port)
+	require.Equal(t, []string{"10.0.0.1:50051", "10.0.0.2:50051"}, cfg.Addresses)
+	require.True(t, cfg.Insecure)
+	require.False(t, cfg.Blocking)
+	require.Zero(t, cfg.Timeout)
+	require.Equal(t, 2*time.Second, cfg.Methods["/pkg.Service/Get"].Timeout)
+
+	err := yaml.Unmarshal([]byte("billing: {host: example.com, port: 443, maxRecvMsgSize: huge}"), &doc)
+	require.ErrorIs(t, err, grpcx.ErrInvalidClientConnectionString)
+	require.ElementsMatch(t, []string{"maxRecvMsgSize"}, optionErrorNames(err))
+}
+
+func TestClientConfigFromEnv(t *testing.T) {
+	t.Run("it should read options from prefixed variables", func(t *testing.T) {
+		t.Setenv("BILLING_GRPC_HOST", "billing.internal")
+		t.Setenv("BILLING_GRPC_PORT", "443")
+		t.Setenv("BILLING_GRPC_TLS_SKIPVERIFY", "true")
+		t.Setenv("BILLING_GRPC_KEEPALIVE_INTERVAL", "30s")
+		t.Setenv("BILLING_GRPC_HEADERS", "x-tenant:acme, accept: a, b,x-team:payments")
+
+		cfg, err := grpcx.ClientConfigFromEnv("BILLING_GRPC")
+		require.NoError(t, err)
+
+		expected, err := grpcx.ParseClientConfig("grpc://billing.internal:443?tls.skipVerify=true&keepAlive.interval=30s&headers=x-tenant:acme&headers=accept:a,%20b&headers=x-team:payments")
+		require.NoError(t, err)
+		require.Equal(t, expected, cfg)
+	})
+
+	t.Run("it should report every invalid variable", func(t *testing.T) {
+		t.Setenv("BILLING_GRPC_HOST", "billing.internal")
+		t.Setenv("BILLING_GRPC_PORT", "https")
+		t.Setenv("BILLING_GRPC_BLOCKING", "maybe")
+
+		_, err := grpcx.ClientConfigFromEnv("BILLING_GRPC_")
+		require.ErrorIs(t, err, grpcx.ErrInvalidClientConnectionString)
+		require.ElementsMatch(t, []string{"port", "blocking"}, optionErrorNames(err))
+	})
+}
+
+func TestClientConfigSources(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		options map[string]string
+		wantErr bool
+	}{
+		{
+			dsn:     "grpc://example.com:8080?tls=false",
+			options: map[string]string{"host": "example.com", "port": "8080", "tls": "false"},
+		},
+		{
+			dsn:     "grpc://:443",
+			options: map[string]string{"port": "443"},
+		},
+		{
+			dsn:     "grpc://?tls=false&resolver.scheme=unix&resolver.path=/run/backend.sock",
+			options: map[string]string{"tls": "false", "resolver.scheme": "unix", "resolver.path": "/run/backend.sock"},
+		},
+		{
+			dsn:     "grpc://example.com",
+			options: map[string]string{"host": "example.com"},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://?tls=false",
+			options: map[string]string{"tls": "false"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			fromDSN, err := grpcx.ParseClientConfig(tt.dsn)
+			require.Equal(t, tt.wantErr, err != nil, "dsn, err = %v", err)
+
+			doc, err := json.Marshal(tt.options)
+			require.NoError(t, err)
+
+			var fromJSON grpcx.ClientConfig
+
+			err = json.Unmarshal(doc, &fromJSON)
+			require.Equal(t, tt.wantErr, err != nil, "json, err = %v", err)
+
+			for name, value := range tt.options {
+				t.Setenv("SOURCES_GRPC_"+strings.ToUpper(strings.ReplaceAll(name, ".", "_")), value)
+			}
+
+			fromEnv, err := grpcx.ClientConfigFromEnv("SOURCES_GRPC")
+			require.Equal(t, tt.wantErr, err != nil, "env, err = %v", err)
+
+			if !tt.wantErr {
+				require.Equal(t, fromDSN, fromJSON)
+				require.Equal(t, fromDSN, fromEnv)
+			}
+		})
+	}
+}
@@ -1,12 +1,29 @@
 package grpcx_test
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
 	"github.com/tangelo-labs/go-grpcx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 )
 
 func TestParseClientConfig(t *testing.T) {
@@ -80,39 +97,44 @@ func TestParseClientConfig(t *testing.T) {
 				Port:     443,
 				Insecure: true,
 				Blocking: false,
-				Timeout:  10 * time.Second,
+				Timeout:  0,
 			},
 		},
 		{
-			dsn: "grpc://example.com:443?tls=false&blocking=false&timeout=10s",
-			want: grpcx.ClientConfig{
-				Host:     "example.com",
-				Port:     443,
-				Insecure: true,
-				Blocking: false,
-				Timeout:  10 * time.Second,
-			},
+			dsn:     "grpc://example.com:443?tls=false&blocking=false&timeout=10s",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
 		},
 		{
-			dsn: "grpc://example.com:443?tls=false&blocking=false&timeout=10s&timeout=20s",
+			dsn: "grpc://example.com:443?tls=false&blocking=true&timeout=10s&timeout=20s",
 			want: grpcx.ClientConfig{
 				Host:     "example.com",
 				Port:     443,
 				Insecure: true,
-				Blocking: false,
+				Blocking: true,
 				Timeout:  10 * time.Second,
 			},
 		},
 		{
-			dsn: "grpc://example.com:443?tls=false&blocking=false&timeout=10s&timeout=20s&timeout=30s",
+			dsn: "grpc://example.com:443?tls=false&blocking=true&timeout=10s&timeout=20s&timeout=30s",
 			want: grpcx.ClientConfig{
 				Host:     "example.com",
 				Port:     443,
 				Insecure: true,
-				Blocking: false,
+				Blocking: true,
 				Timeout:  10 * time.Second,
 			},
 		},
+		{
+			dsn:     "grpc://example.com:0",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?tls=false&tls.serverName=example.com",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
 		{
 			dsn:     "grpc://example.com:443?tls=false&blocking=false&timeout=xxxx",
 			want:    grpcx.ClientConfig{},
@@ -214,6 +236,180 @@ func TestParseClientConfig(t *testing.T) {
 				DefaultServiceConfig: `{"loadBalancingPolicy":"pick_first"}`,
 			},
 		},
+		{
+			dsn: "grpc://example.com:443?pool=8",
+			want: grpcx.ClientConfig{
+				Host:     "example.com",
+				Port:     443,
+				Insecure: false,
+				Blocking: true,
+				Timeout:  10 * time.Second,
+				PoolSize: 8,
+			},
+		},
+		{
+			dsn: "grpc://example.com:443?pool=8&pool.strategy=least_outstanding",
+			want: grpcx.ClientConfig{
+				Host:         "example.com",
+				Port:         443,
+				Insecure:     false,
+				Blocking:     true,
+				Timeout:      10 * time.Second,
+				PoolSize:     8,
+				PoolStrategy: grpcx.PoolStrategyLeastOutstanding,
+			},
+		},
+		{
+			dsn: "grpc://example.com:443?pool=8&pool.maxConnectionAge=30m&pool.maxConnectionAgeJitter=1m",
+			want: grpcx.ClientConfig{
+				Host:                       "example.com",
+				Port:                       443,
+				Insecure:                   false,
+				Blocking:                   true,
+				Timeout:                    10 * time.Second,
+				PoolSize:                   8,
+				PoolMaxConnectionAge:       30 * time.Minute,
+				PoolMaxConnectionAgeJitter: time.Minute,
+			},
+		},
+		{
+			dsn:     "grpc://example.com:443?pool=8&pool.maxConnectionAge=1m&pool.maxConnectionAgeJitter=2m",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?pool=8&pool.strategy=random",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?pool=0",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?pool=xxxx",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn: "grpc://10.0.0.1:50051,10.0.0.2:50052,[::1]:50053?defaultServiceConfig=lbp-round_robin",
+			want: grpcx.ClientConfig{
+				Host:                 "10.0.0.1",
+				Port:                 50051,
+				Addresses:            []string{"10.0.0.1:50051", "10.0.0.2:50052", "[::1]:50053"},
+				Insecure:             false,
+				Blocking:             true,
+				Timeout:              10 * time.Second,
+				DefaultServiceConfig: `{"loadBalancingPolicy":"round_robin"}`,
+			},
+		},
+		{
+			dsn: "grpc://example.com:443?maxRecvMsgSize=16MB&maxSendMsgSize=1048576&compressor=gzip&initialWindowSize=1MiB&initialConnWindowSize=2M&readBufferSize=64KB&writeBufferSize=128K",
+			want: grpcx.ClientConfig{
+				Host:                  "example.com",
+				Port:                  443,
+				Insecure:              false,
+				Blocking:              true,
+				Timeout:               10 * time.Second,
+				MaxRecvMsgSize:        16 << 20,
+				MaxSendMsgSize:        1 << 20,
+				Compressor:            "gzip",
+				InitialWindowSize:     1 << 20,
+				InitialConnWindowSize: 2 << 20,
+				ReadBufferSize:        64 << 10,
+				WriteBufferSize:       128 << 10,
+			},
+		},
+		{
+			dsn:     "grpc://example.com:443?maxRecvMsgSize=-1",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?maxRecvMsgSize=4TB",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?initialWindowSize=1KB",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?initialConnWindowSize=4GB",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?compressor=zstd-unknown",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://10.0.0.1:50051,10.0.0.2?tls=false",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://10.0.0.1:50051,10.0.0.2:0",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://10.0.0.1:50051,10.0.0.2:50052?resolver.scheme=dns",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?resolver.scheme=unregistered",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://example.com:443?resolver.authority=8.8.8.8:53",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn:     "grpc://?resolver.scheme=unix",
+			want:    grpcx.ClientConfig{},
+			wantErr: true,
+		},
+		{
+			dsn: "grpc://example.com:443?resolver.scheme=dns&resolver.authority=8.8.8.8:53",
+			want: grpcx.ClientConfig{
+				Host:              "example.com",
+				Port:              443,
+				Blocking:          true,
+				Timeout:           10 * time.Second,
+				ResolverScheme:    "dns",
+				ResolverAuthority: "8.8.8.8:53",
+			},
+			wantErr: false,
+		},
+		{
+			dsn: "grpc://?tls=false&resolver.scheme=unix&resolver.path=/var/run/backend.sock",
+			want: grpcx.ClientConfig{
+				Insecure:       true,
+				Blocking:       true,
+				Timeout:        10 * time.Second,
+				ResolverScheme: "unix",
+				ResolverPath:   "/var/run/backend.sock",
+			},
+			wantErr: false,
+		},
+		{
+			dsn: "grpc://?tls=false&resolver.scheme=unix&resolver.endpoint=/var/run/backend.sock",
+			want: grpcx.ClientConfig{
+				Insecure:       true,
+				Blocking:       true,
+				Timeout:        10 * time.Second,
+				ResolverScheme: "unix",
+				ResolverPath:   "/var/run/backend.sock",
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -232,6 +428,182 @@ func TestParseClientConfig(t *testing.T) {
 	}
 }
 
+func TestParseClientConfigDial(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("it should return a single connection when no pool is given", func(t *testing.T) {
+		conn, err := grpcx.ParseClientConfigDial(ctx, "grpc://127.0.0.1:50051?tls=false&blocking=false")
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		require.IsType(t, &grpc.ClientConn{}, conn)
+	})
+
+	t.Run("it should return a connection pool when pool is given", func(t *testing.T) {
+		conn, err := grpcx.ParseClientConfigDial(ctx, "grpc://127.0.0.1:50051?tls=false&blocking=false&pool=3")
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		_, isSingle := conn.(*grpc.ClientConn)
+		require.False(t, isSingle)
+	})
+}
+
+func TestParseClientConfigDial_MultipleAddresses(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var hits [2]atomic.Int32
+
+	addrs := make([]string, len(hits))
+
+	for i := range hits {
+		counter := &hits[i]
+		addrs[i], _ = startTestServer(t, "127.0.0.1:0", grpc.UnaryInterceptor(
+			func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				counter.Add(1)
+
+				return handler(ctx, req)
+			},
+		))
+	}
+
+	dsn := fmt.Sprintf("grpc://%s?tls=false&defaultServiceConfig=lbp-round_robin", strings.Join(addrs, ","))
+
+	conn, err := grpcx.ParseClientConfigDial(ctx, dsn)
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	require.Eventually(t, func() bool {
+		if _, cErr := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true)); cErr != nil {
+			return false
+		}
+
+		return hits[0].Load() > 0 && hits[1].Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestParseClientConfigDial_MessageOptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	encodings := &encodingRecorder{}
+
+	addr, _ := startTestServer(t, "127.0.0.1:0", grpc.StatsHandler(encodings))
+	req := &grpc_health_v1.HealthCheckRequest{Service: strings.Repeat("x", 2048)}
+
+	t.Run("it should compress messages", func(t *testing.T) {
+		conn, err := grpcx.ParseClientConfigDial(ctx, fmt.Sprintf("grpc://%s?tls=false&compressor=gzip", addr))
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, req)
+		require.Equal(t, codes.NotFound, status.Code(err))
+		require.Equal(t, []string{"gzip"}, encodings.all())
+	})
+
+	t.Run("it should reject messages larger than maxSendMsgSize", func(t *testing.T) {
+		conn, err := grpcx.ParseClientConfigDial(ctx, fmt.Sprintf("grpc://%s?tls=false&maxSendMsgSize=1KB", addr))
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, req)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+}
+
+func TestParseClientConfigDial_Resolvers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("it should accept any registered scheme", func(t *testing.T) {
+		addr, _ := startTestServer(t, "127.0.0.1:0")
+
+		r := manual.NewBuilderWithScheme("grpcx-test-registered")
+		r.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: addr}}})
+		resolver.Register(r)
+
+		conn, err := grpcx.ParseClientConfigDial(ctx, "grpc://backend.internal:50051?tls=false&resolver.scheme=grpcx-test-registered")
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	})
+
+	t.Run("it should dial unix sockets", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "backend.sock")
+
+		lis, err := net.Listen("unix", socket)
+		require.NoError(t, err)
+
+		srv := grpc.NewServer()
+		grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+
+		go func() {
+			_ = srv.Serve(lis)
+		}()
+
+		defer srv.Stop()
+
+		cfg, err := grpcx.ParseClientConfig("grpc://?tls=false&resolver.scheme=unix&resolver.path=" + socket)
+		require.NoError(t, err)
+
+		roundTrip, err := grpcx.ParseClientConfig(cfg.DSN())
+		require.NoError(t, err)
+		require.Equal(t, cfg, roundTrip)
+
+		conn, err := cfg.NewDialer().Dial(ctx)
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	})
+
+	t.Run("it should dial unix sockets relative to the working directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "run"), 0o700))
+
+		lis, err := net.Listen("unix", filepath.Join(dir, "run", "backend.sock"))
+		require.NoError(t, err)
+
+		srv := grpc.NewServer()
+		grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+
+		go func() {
+			_ = srv.Serve(lis)
+		}()
+
+		defer srv.Stop()
+
+		wd, err := os.Getwd()
+		require.NoError(t, err)
+		require.NoError(t, os.Chdir(dir))
+
+		t.Cleanup(func() {
+			_ = os.Chdir(wd)
+		})
+
+		conn, err := grpcx.ParseClientConfigDial(ctx, "grpc://?tls=false&resolver.scheme=unix&resolver.path=run/backend.sock")
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	})
+}
+
 func TestParseHostAndPort(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -263,3 +635,54 @@ func TestParseHostAndPort(t *testing.T) {
 		})
 	}
 }
+
+// startTestServer starts a gRPC server listening on the given address and
+// exposing the standard health service. It returns the actual address and a
+// function to stop the server.
+// encodingRecorder is a server stats handler that records the grpc-encoding
+// header of incoming calls.
+type encodingRecorder struct {
+	mu        sync.Mutex
+	encodings []string
+}
+
+func (r *encodingRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *encodingRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.InHeader); ok {
+		r.mu.Lock()
+		r.encodings = append(r.encodings, h.Compression)
+		r.mu.Unlock()
+	}
+}
+
+func (r *encodingRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *encodingRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+func (r *encodingRecorder) all() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.encodings...)
+}
+
+func startTestServer(t *testing.T, addr string, opts ...grpc.ServerOption) (string, func()) {
+	lis, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	srv := grpc.NewServer(opts...)
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String(), srv.Stop
+}
@@ -0,0 +1,496 @@
+package grpcx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported prefixes for secret sources, such as TLS key passwords.
+const (
+	secretSourcePass = "pass:"
+	secretSourceEnv  = "env:"
+	secretSourceFile = "file:"
+)
+
+// loadTLSKeyPair loads the client certificate referenced by TLSCertFile and
+// TLSKeyFile, if any, into the TLS configuration.
+func (cfg *ClientConfig) loadTLSKeyPair() error {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil
+	}
+
+	cert, err := loadClientCertificate(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSKeyPassword)
+	if err != nil {
+		return err
+	}
+
+	if cfg.TLS == nil {
+		cfg.TLS = &tls.Config{}
+	}
+
+	cfg.TLS.Certificates = []tls.Certificate{cert}
+
+	return nil
+}
+
+// loadClientCertificate reads a PEM encoded certificate and private key pair
+// from the given paths. If the key is encrypted, it is decrypted using the
+// password obtained from the given secret source.
+func loadClientCertificate(certFile, keyFile, passwordSource string) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not read tls.cert file `%s`, details = %w", certFile, err)
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not read tls.key file `%s`, details = %w", keyFile, err)
+	}
+
+	if passwordSource != "" {
+		password, pErr := resolveSecretSource(passwordSource)
+		if pErr != nil {
+			return tls.Certificate{}, fmt.Errorf("could not resolve tls.keyPassword, details = %w", pErr)
+		}
+
+		keyPEM, err = decryptPEMKey(keyPEM, []byte(password))
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("could not decrypt tls.key file `%s`, details = %w", keyFile, err)
+		}
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("invalid tls.cert and tls.key pair, details = %w", err)
+	}
+
+	return cert, nil
+}
+
+// decryptPEMKey decrypts the given PEM encoded private key if it is encrypted
+// using the legacy RFC 1423 encryption, otherwise it is returned as is.
+func decryptPEMKey(keyPEM, password []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, fmt.Errorf("encrypted PKCS#8 keys are not supported")
+	}
+
+	//nolint:staticcheck // RFC 1423 is the only PEM encryption supported by the standard library.
+	if !x509.IsEncryptedPEMBlock(block) {
+		return keyPEM, nil
+	}
+
+	//nolint:staticcheck // RFC 1423 is the only PEM encryption supported by the standard library.
+	der, err := x509.DecryptPEMBlock(block, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+}
+
+// isSecretSource whether the given string is a valid secret source
+// reference.
+func isSecretSource(src string) bool {
+	return strings.HasPrefix(src, secretSourcePass) ||
+		strings.HasPrefix(src, secretSourceEnv) ||
+		strings.HasPrefix(src, secretSourceFile)
+}
+
+// resolveSecretSource resolves the given secret source reference, which must
+// be in one of the following forms:
+//
+//   - `pass:<password>`: the password is given literally.
+//   - `env:<var>`: the password is read from the given environment variable.
+//   - `file:<path>`: the password is read from the given file, trailing new
+//     lines are ignored.
+func resolveSecretSource(src string) (string, error) {
+	switch {
+	case strings.HasPrefix(src, secretSourcePass):
+		return strings.TrimPrefix(src, secretSourcePass), nil
+	case strings.HasPrefix(src, secretSourceEnv):
+		name := strings.TrimPrefix(src, secretSourceEnv)
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable `%s` is not defined", name)
+		}
+
+		return value, nil
+	case strings.HasPrefix(src, secretSourceFile):
+		path := strings.TrimPrefix(src, secretSourceFile)
+
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(value), "\r\n"), nil
+	}
+
+	return "", fmt.Errorf("unknown secret source")
+}
+
+// tlsReloader serves the TLS material referenced by a ClientConfig (root CAs
+// and client key pair), reloading it from disk whenever the referenced files
+// change. Files are checked on every new TLS handshake, so long-lived
+// connections pick up rotated material when they reconnect.
+//
+// If reloading fails, for instance because a certificate was rewritten but
+// its key was not yet, the previous material is kept and reloading is retried
+// on the next handshake.
+type tlsReloader struct {
+	rootCAsFile string
+	certFile    string
+	keyFile     string
+	keyPassword string
+
+	mu      sync.Mutex
+	rootCAs *x509.CertPool
+	cert    *tls.Certificate
+	stamps  map[string]fileStamp
+}
+
+// fileStamp captures the state of a file at a given time, used to detect
+// changes.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// newTLSReloader builds a new tlsReloader for the files referenced by the
+// given config, nil is returned if the config does not reference any file.
+func newTLSReloader(cfg *ClientConfig) *tlsReloader {
+	if cfg.Insecure || (cfg.TLSRootCAsFile == "" && cfg.TLSCertFile == "" && cfg.TLSKeyFile == "") {
+		return nil
+	}
+
+	r := &tlsReloader{
+		rootCAsFile: cfg.TLSRootCAsFile,
+		keyPassword: cfg.TLSKeyPassword,
+		stamps:      make(map[string]fileStamp),
+	}
+
+	if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+		r.certFile = cfg.TLSCertFile
+		r.keyFile = cfg.TLSKeyFile
+	}
+
+	if cfg.TLS != nil {
+		r.rootCAs = cfg.TLS.RootCAs
+
+		if len(cfg.TLS.Certificates) > 0 {
+			r.cert = &cfg.TLS.Certificates[0]
+		}
+	}
+
+	return r
+}
+
+// apply hooks the reloader into the given TLS configuration. The given
+// serverName is used to verify server certificates when the handshake does
+// not carry one, e.g. when dialing an IP address.
+func (r *tlsReloader) apply(tlsCfg *tls.Config, serverName string) {
+	if r.certFile != "" {
+		tlsCfg.Certificates = nil
+		tlsCfg.GetClientCertificate = r.getClientCertificate
+	}
+
+	if r.rootCAsFile != "" && !tlsCfg.InsecureSkipVerify {
+		if tlsCfg.ServerName != "" {
+			serverName = tlsCfg.ServerName
+		}
+
+		next := tlsCfg.VerifyConnection
+		tlsCfg.RootCAs = nil
+		tlsCfg.InsecureSkipVerify = true
+		tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if err := r.verifyConnection(cs, serverName); err != nil {
+				return err
+			}
+
+			if next != nil {
+				return next(cs)
+			}
+
+			return nil
+		}
+	}
+}
+
+func (r *tlsReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reload()
+
+	if r.cert == nil {
+		return &tls.Certificate{}, nil
+	}
+
+	return r.cert, nil
+}
+
+// verifyConnection verifies the server certificate chain against the current
+// set of root CAs, as the standard library would do if InsecureSkipVerify was
+// not set.
+func (r *tlsReloader) verifyConnection(cs tls.ConnectionState, serverName string) error {
+	r.mu.Lock()
+	r.reload()
+	roots := r.rootCAs
+	r.mu.Unlock()
+
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("tls: server did not present a certificate")
+	}
+
+	if cs.ServerName != "" {
+		serverName = cs.ServerName
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		return fmt.Errorf("tls: failed to verify server certificate, details = %w", err)
+	}
+
+	return nil
+}
+
+// reload reloads any material whose files changed since the last successful
+// load. Must be called while holding the lock.
+func (r *tlsReloader) reload() {
+	if r.rootCAsFile != "" {
+		if st, changed := r.changed(r.rootCAsFile); changed {
+			if pool, err := loadCertPool(r.rootCAsFile); err == nil {
+				r.rootCAs = pool
+				r.stamps[r.rootCAsFile] = st
+			}
+		}
+	}
+
+	if r.certFile != "" {
+		certStamp, certChanged := r.changed(r.certFile)
+		keyStamp, keyChanged := r.changed(r.keyFile)
+
+		if certChanged || keyChanged {
+			if cert, err := loadClientCertificate(r.certFile, r.keyFile, r.keyPassword); err == nil {
+				r.cert = &cert
+				r.stamps[r.certFile] = certStamp
+				r.stamps[r.keyFile] = keyStamp
+			}
+		}
+	}
+}
+
+// changed whether the given file changed since it was last loaded, along with
+// its current stamp.
+func (r *tlsReloader) changed(path string) (fileStamp, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, false
+	}
+
+	current := fileStamp{modTime: info.ModTime(), size: info.Size()}
+	last, ok := r.stamps[path]
+
+	return current, !ok || !current.modTime.Equal(last.modTime) || current.size != last.size
+}
+
+// loadCertPool reads a PEM encoded list of certificates from the given path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	certBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(certBytes) {
+		return nil, fmt.Errorf("no certificates found in `%s`", path)
+	}
+
+	return pool, nil
+}
+
+// tlsVersionNames human readable names of the supported TLS versions.
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "1.0",
+	tls.VersionTLS11: "1.1",
+	tls.VersionTLS12: "1.2",
+	tls.VersionTLS13: "1.3",
+}
+
+// curveNames canonical names of the supported elliptic curves, along with
+// accepted aliases.
+var curveNames = map[tls.CurveID][]string{
+	tls.X25519:    {"X25519"},
+	tls.CurveP256: {"P256", "P-256", "CurveP256", "secp256r1"},
+	tls.CurveP384: {"P384", "P-384", "CurveP384", "secp384r1"},
+	tls.CurveP521: {"P521", "P-521", "CurveP521", "secp521r1"},
+}
+
+// parseTLSVersion parses a TLS version given either by name, e.g. `1.2`,
+// `TLS1.2`, `TLSv1.2` or `TLS12`, or by its numeric identifier, e.g. `771`.
+func parseTLSVersion(s string) (uint16, error) {
+	if n, err := strconv.ParseUint(s, 10, 16); err == nil {
+		if _, ok := tlsVersionNames[uint16(n)]; ok {
+			return uint16(n), nil
+		}
+	}
+
+	name := strings.ToUpper(strings.TrimSpace(s))
+	name = strings.TrimPrefix(name, "TLS")
+	name = strings.TrimPrefix(strings.TrimSpace(name), "V")
+
+	if len(name) == 2 && !strings.Contains(name, ".") {
+		name = name[:1] + "." + name[1:]
+	}
+
+	for ver, verName := range tlsVersionNames {
+		if name == verName {
+			return ver, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown TLS version `%s`, expecting one of `1.0`, `1.1`, `1.2` or `1.3`", s)
+}
+
+// parseCipherSuite parses a cipher suite given by its crypto/tls name.
+// Insecure and TLS 1.3 cipher suites are rejected.
+func parseCipherSuite(name string) (uint16, error) {
+	for _, cs := range tls.InsecureCipherSuites() {
+		if cs.Name == name {
+			return 0, fmt.Errorf("cipher suite `%s` is insecure", name)
+		}
+	}
+
+	for _, cs := range tls.CipherSuites() {
+		if cs.Name != name {
+			continue
+		}
+
+		if len(cs.SupportedVersions) == 1 && cs.SupportedVersions[0] == tls.VersionTLS13 {
+			return 0, fmt.Errorf("cipher suite `%s` is not configurable, TLS 1.3 suites are always enabled", name)
+		}
+
+		return cs.ID, nil
+	}
+
+	return 0, fmt.Errorf("unknown cipher suite `%s`", name)
+}
+
+// parseCurve parses a supported elliptic curve given by name, e.g. `X25519`
+// or `P256`, or by its numeric identifier.
+func parseCurve(name string) (tls.CurveID, error) {
+	for id, aliases := range curveNames {
+		for _, alias := range aliases {
+			if strings.EqualFold(alias, name) {
+				return id, nil
+			}
+		}
+	}
+
+	if n, err := strconv.ParseUint(name, 10, 16); err == nil {
+		if _, ok := curveNames[tls.CurveID(n)]; ok {
+			return tls.CurveID(n), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown curve `%s`", name)
+}
+
+// curveName returns the canonical name of the given curve, or its numeric
+// identifier if unknown.
+func curveName(id tls.CurveID) string {
+	if aliases, ok := curveNames[id]; ok {
+		return aliases[0]
+	}
+
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// tlsVersionName returns the human readable name of the given TLS version, or
+// its numeric identifier if unknown.
+func tlsVersionName(ver uint16) string {
+	if name, ok := tlsVersionNames[ver]; ok {
+		return name
+	}
+
+	return strconv.FormatUint(uint64(ver), 10)
+}
+
+// validateTLSConfig checks that the TLS version bounds and the cipher suites
+// of the given config are secure and can actually be negotiated.
+func validateTLSConfig(cfg *tls.Config) error {
+	if cfg == nil {
+		return nil
+	}
+
+	minVersion, maxVersion := cfg.MinVersion, cfg.MaxVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	if minVersion < tls.VersionTLS12 {
+		return fmt.Errorf("tls.minVersion `%s` is insecure, TLS 1.2 or later is required", tlsVersionName(minVersion))
+	}
+
+	if maxVersion == 0 {
+		maxVersion = tls.VersionTLS13
+	}
+
+	if minVersion > maxVersion {
+		return fmt.Errorf("tls.minVersion `%s` is greater than tls.maxVersion `%s`", tlsVersionName(minVersion), tlsVersionName(maxVersion))
+	}
+
+	if len(cfg.CipherSuites) == 0 {
+		return nil
+	}
+
+	if minVersion == tls.VersionTLS13 {
+		return fmt.Errorf("tls.cipherSuites has no effect when only TLS 1.3 is allowed")
+	}
+
+	for _, cs := range tls.CipherSuites() {
+		if !containsUint16(cfg.CipherSuites, cs.ID) {
+			continue
+		}
+
+		for _, ver := range cs.SupportedVersions {
+			if ver >= minVersion && ver <= maxVersion {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("none of tls.cipherSuites supports TLS versions from `%s` to `%s`", tlsVersionName(minVersion), tlsVersionName(maxVersion))
+}
+
+func containsUint16(list []uint16, v uint16) bool {
+	for i := range list {
+		if list[i] == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,333 @@
+package grpcx_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestParseClientConfig_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	client := newTestLeaf(t, ca, "client")
+
+	certFile := writeTestFile(t, dir, "client.crt", client.certPEM)
+	keyFile := writeTestFile(t, dir, "client.key", client.keyPEM)
+	encKeyFile := writeTestFile(t, dir, "client.enc.key", client.encryptedKeyPEM(t, "s3cr3t"))
+	passFile := writeTestFile(t, dir, "password", []byte("s3cr3t\n"))
+
+	t.Setenv("GRPCX_TEST_KEY_PASSWORD", "s3cr3t")
+
+	t.Run("it should load a plain key pair", func(t *testing.T) {
+		cfg, err := grpcx.ParseClientConfig(fmt.Sprintf("grpc://example.com:443?tls.cert=%s&tls.key=%s", certFile, keyFile))
+		require.NoError(t, err)
+		require.Len(t, cfg.TLS.Certificates, 1)
+		require.Equal(t, certFile, cfg.TLSCertFile)
+		require.Equal(t, keyFile, cfg.TLSKeyFile)
+	})
+
+	for _, source := range []string{"pass:s3cr3t", "env:GRPCX_TEST_KEY_PASSWORD", "file:" + passFile, "@file:" + passFile, "${GRPCX_TEST_KEY_PASSWORD}"} {
+		source := source
+
+		t.Run("it should decrypt an encrypted key using "+source, func(t *testing.T) {
+			dsn := fmt.Sprintf("grpc://example.com:443?tls.cert=%s&tls.key=%s&tls.keyPassword=%s", certFile, encKeyFile, url.QueryEscape(source))
+
+			cfg, err := grpcx.ParseClientConfig(dsn)
+			require.NoError(t, err)
+			require.Len(t, cfg.TLS.Certificates, 1)
+		})
+	}
+
+	invalid := map[string]string{
+		"it should fail when key is missing":        fmt.Sprintf("grpc://example.com:443?tls.cert=%s", certFile),
+		"it should fail when cert is missing":       fmt.Sprintf("grpc://example.com:443?tls.key=%s", keyFile),
+		"it should fail when cert does not exist":   fmt.Sprintf("grpc://example.com:443?tls.cert=%s/nope&tls.key=%s", dir, keyFile),
+		"it should fail on wrong password":          fmt.Sprintf("grpc://example.com:443?tls.cert=%s&tls.key=%s&tls.keyPassword=pass:wrong", certFile, encKeyFile),
+		"it should fail on encrypted key alone":     fmt.Sprintf("grpc://example.com:443?tls.cert=%s&tls.key=%s", certFile, encKeyFile),
+		"it should fail on unknown password source": fmt.Sprintf("grpc://example.com:443?tls.cert=%s&tls.key=%s&tls.keyPassword=s3cr3t", certFile, encKeyFile),
+		"it should fail on undefined password env":  fmt.Sprintf("grpc://example.com:443?tls.cert=%s&tls.key=%s&tls.keyPassword=env:GRPCX_UNDEFINED", certFile, encKeyFile),
+	}
+
+	for name, dsn := range invalid {
+		dsn := dsn
+
+		t.Run(name, func(t *testing.T) {
+			_, err := grpcx.ParseClientConfig(dsn)
+			require.ErrorIs(t, err, grpcx.ErrInvalidClientConnectionString)
+		})
+	}
+}
+
+func TestParseClientConfig_TLSVersionsAndCiphers(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want *tls.Config
+	}{
+		{
+			dsn:  "grpc://example.com:443?tls.minVersion=1.2&tls.maxVersion=TLS1.3",
+			want: &tls.Config{MinVersion: tls.VersionTLS12, MaxVersion: tls.VersionTLS13},
+		},
+		{
+			dsn:  "grpc://example.com:443?tls.minVersion=TLSv1.2&tls.maxVersion=tls12",
+			want: &tls.Config{MinVersion: tls.VersionTLS12, MaxVersion: tls.VersionTLS12},
+		},
+		{
+			dsn:  "grpc://example.com:443?tls.minVersion=771",
+			want: &tls.Config{MinVersion: tls.VersionTLS12},
+		},
+		{
+			dsn: "grpc://example.com:443?tls.cipherSuites=TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384&tls.curves=X25519,23",
+			want: &tls.Config{
+				CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+				CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			cfg, err := grpcx.ParseClientConfig(tt.dsn)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, cfg.TLS)
+		})
+	}
+
+	invalid := []string{
+		"grpc://example.com:443?tls.minVersion=1.4",
+		"grpc://example.com:443?tls.minVersion=12345",
+		"grpc://example.com:443?tls.minVersion=SSL3",
+		"grpc://example.com:443?tls.minVersion=1.3&tls.maxVersion=1.2",
+		"grpc://example.com:443?tls.cipherSuites=TLS_RSA_WITH_RC4_128_SHA",
+		"grpc://example.com:443?tls.cipherSuites=TLS_AES_128_GCM_SHA256",
+		"grpc://example.com:443?tls.cipherSuites=NOPE",
+		"grpc://example.com:443?tls.cipherSuites=TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256&tls.minVersion=1.3",
+		"grpc://example.com:443?tls.cipherSuites=TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256&tls.minVersion=1.0&tls.maxVersion=1.1",
+		"grpc://example.com:443?tls.minVersion=1.0",
+		"grpc://example.com:443?tls.minVersion=TLSv1.1&tls.maxVersion=1.2",
+		"grpc://example.com:443?tls.curves=P-999",
+		"grpc://example.com:443?tls.curves=0",
+		"grpc://example.com:443?tls.curves=65535",
+	}
+
+	for _, dsn := range invalid {
+		_, err := grpcx.ParseClientConfig(dsn)
+		require.ErrorIs(t, err, grpcx.ErrInvalidClientConnectionString, dsn)
+	}
+}
+
+func TestParseClientConfigDial_MutualTLS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	server := newTestLeaf(t, ca, "localhost")
+	client := newTestLeaf(t, ca, "client")
+
+	caFile := writeTestFile(t, dir, "ca.crt", ca.certPEM)
+	certFile := writeTestFile(t, dir, "client.crt", client.certPEM)
+	keyFile := writeTestFile(t, dir, "client.key", client.keyPEM)
+
+	addr, _ := startTestServer(t, "127.0.0.1:0", grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate(t)},
+		ClientCAs:    ca.pool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})))
+
+	t.Run("it should connect when presenting a client certificate", func(t *testing.T) {
+		dsn := fmt.Sprintf("grpc://%s?tls.rootCAs=%s&tls.serverName=localhost&tls.cert=%s&tls.key=%s&timeout=5s", addr, caFile, certFile, keyFile)
+
+		conn, err := grpcx.ParseClientConfigDial(ctx, dsn)
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		res, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, res.GetStatus())
+	})
+
+	t.Run("it should fail when no client certificate is presented", func(t *testing.T) {
+		dsn := fmt.Sprintf("grpc://%s?tls.rootCAs=%s&tls.serverName=localhost&blocking=false", addr, caFile)
+
+		conn, err := grpcx.ParseClientConfigDial(ctx, dsn)
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		callCtx, callCancel := context.WithTimeout(ctx, time.Second)
+		defer callCancel()
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(callCtx, &grpc_health_v1.HealthCheckRequest{})
+		require.Error(t, err)
+	})
+}
+
+func TestDialer_TLSRotation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+
+	// rotate writes a new CA and client key pair to disk, and returns server
+	// credentials signed by the new CA that only accept clients signed by it.
+	rotate := func() credentials.TransportCredentials {
+		ca := newTestCA(t, "test-ca")
+		server := newTestLeaf(t, ca, "localhost")
+		client := newTestLeaf(t, ca, "client")
+
+		writeTestFile(t, dir, "ca.crt", ca.certPEM)
+		writeTestFile(t, dir, "client.crt", client.certPEM)
+		writeTestFile(t, dir, "client.key", client.keyPEM)
+
+		return credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{server.tlsCertificate(t)},
+			ClientCAs:    ca.pool(),
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS12,
+		})
+	}
+
+	addr, stop := startTestServer(t, "127.0.0.1:0", grpc.Creds(rotate()))
+	dsn := fmt.Sprintf("grpc://%s?tls.rootCAs=%s&tls.cert=%s&tls.key=%s&timeout=5s", addr, caFile, certFile, keyFile)
+
+	cfg, err := grpcx.ParseClientConfig(dsn)
+	require.NoError(t, err)
+
+	conn, err := cfg.NewDialer().Dial(ctx)
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	// Restart the server with material issued by a brand-new CA, the same
+	// connection must reconnect using the rotated files.
+	stop()
+	startTestServer(t, addr, grpc.Creds(rotate()))
+
+	require.Eventually(t, func() bool {
+		_, cErr := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+
+		return cErr == nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+// testCert is a certificate generated at test time along with its private
+// key.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+
+	return pool
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func (c *testCert) encryptedKeyPEM(t *testing.T, password string) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	//nolint:staticcheck // legacy PEM encryption is what we are testing.
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte(password), x509.PEMCipherAES256)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(block)
+}
+
+func newTestCA(t *testing.T, cn string) *testCert {
+	return newTestCert(t, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	})
+}
+
+func newTestLeaf(t *testing.T, ca *testCert, cn string) *testCert {
+	return newTestCert(t, ca, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		DNSNames:    []string{cn},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+}
+
+func newTestCert(t *testing.T, parent *testCert, template *x509.Certificate) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	return path
+}
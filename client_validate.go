@@ -0,0 +1,295 @@
+package grpcx
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// ClientOptionError describes a problem found with a single option of a
+// ClientConfig, options are named after their connection string counterpart
+// (see ParseClientConfig). It wraps ErrInvalidClientConnectionString.
+type ClientOptionError struct {
+	// Option name of the offending option, e.g. `timeout`.
+	Option string
+
+	// Value offending value, as given or as represented in a connection
+	// string.
+	Value string
+
+	// Reason describes why the value is invalid.
+	Reason string
+
+	// Err underlying error, if any.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ClientOptionError) Error() string {
+	return fmt.Sprintf("%s: option `%s` with value `%s`, %s", ErrInvalidClientConnectionString, e.Option, e.Value, e.Reason)
+}
+
+// Unwrap allows matching ErrInvalidClientConnectionString and the underlying
+// error, if any, using errors.Is and errors.As.
+func (e *ClientOptionError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrInvalidClientConnectionString}
+	}
+
+	return []error{ErrInvalidClientConnectionString, e.Err}
+}
+
+// newClientOptionError builds a ClientOptionError out of an error returned by
+// an option parser, which is expected to be prefixed by
+// ErrInvalidClientConnectionString.
+func newClientOptionError(option, value string, err error) *ClientOptionError {
+	reason := strings.TrimPrefix(err.Error(), ErrInvalidClientConnectionString.Error()+": ")
+
+	return &ClientOptionError{
+		Option: option,
+		Value:  value,
+		Reason: reason,
+		Err:    err,
+	}
+}
+
+// Validate checks that this config is consistent and can be used to dial a
+// backend. Every problem found is reported as a ClientOptionError, all of
+// them joined into the returned error (see errors.Join), so they can be fixed
+// at once.
+func (cfg ClientConfig) Validate() error {
+	var errs []error
+
+	invalid := func(option, value, reason string, err error) {
+		errs = append(errs, &ClientOptionError{Option: option, Value: value, Reason: reason, Err: err})
+	}
+
+	if len(cfg.Addresses) <= 1 && cfg.resolverPath() == "" && (cfg.Port < 1 || cfg.Port > 65535) {
+		invalid("port", strconv.Itoa(cfg.Port), "port is out of range [1, 65535]", nil)
+	}
+
+	for _, address := range cfg.Addresses {
+		_, port, err := net.SplitHostPort(address)
+		if err != nil {
+			invalid("address", address, "address must be in the form host:port", err)
+
+			continue
+		}
+
+		if p, pErr := strconv.Atoi(port); pErr != nil || p < 1 || p > 65535 {
+			invalid("address", address, "port is out of range [1, 65535]", pErr)
+		}
+	}
+
+	if len(cfg.Addresses) > 1 && cfg.ResolverScheme != "" {
+		invalid("resolver.scheme", cfg.ResolverScheme, "cannot be used along with multiple addresses", nil)
+	}
+
+	if cfg.ResolverAuthority != "" && cfg.ResolverScheme == "" {
+		invalid("resolver.authority", cfg.ResolverAuthority, "resolver.authority requires resolver.scheme", nil)
+	}
+
+	if cfg.ResolverScheme == FileResolverScheme && !filepath.IsAbs(cfg.resolverPath()) {
+		invalid("resolver.path", cfg.resolverPath(), "the file resolver requires an absolute resolver.path", nil)
+	}
+
+	if cfg.resolverPath() != "" && cfg.ResolverScheme == "" {
+		invalid("resolver.path", cfg.resolverPath(), "resolver.path requires resolver.scheme", nil)
+	}
+
+	if cfg.Proxy != nil {
+		if err := validateProxyURL(cfg.Proxy); err != nil {
+			invalid("proxy", cfg.Proxy.Redacted(), err.Error(), err)
+		}
+
+		if cfg.ResolverScheme == "unix" {
+			invalid("proxy", cfg.Proxy.Redacted(), "cannot be used along with unix sockets", nil)
+		}
+	}
+
+	if cfg.Insecure && (cfg.TLS != nil || cfg.TLSRootCAsFile != "" || cfg.TLSCertFile != "" || cfg.TLSKeyFile != "") {
+		invalid("tls", "false", "TLS settings cannot be used along with an insecure connection", nil)
+	}
+
+	switch {
+	case cfg.TLSCertFile != "" && cfg.TLSKeyFile == "":
+		invalid("tls.key", "", "tls.cert and tls.key must be provided together", nil)
+	case cfg.TLSCertFile == "" && cfg.TLSKeyFile != "":
+		invalid("tls.cert", "", "tls.cert and tls.key must be provided together", nil)
+	case cfg.TLSKeyPassword != "" && cfg.TLSKeyFile == "":
+		invalid("tls.keyPassword", redactedValue, "tls.keyPassword requires tls.cert and tls.key", nil)
+	case cfg.TLSKeyPassword != "" && !isSecretSource(cfg.TLSKeyPassword):
+		invalid("tls.keyPassword", redactedValue, "expecting `pass:<password>`, `env:<var>` or `file:<path>`", nil)
+	}
+
+	if err := validateTLSConfig(cfg.TLS); err != nil {
+		invalid("tls", cfg.tlsOptionsValue(), err.Error(), err)
+	}
+
+	if cfg.Auth != nil {
+		cfg.Auth.validate(invalid)
+
+		if cfg.PerRPCCredentials != nil {
+			invalid("auth", cfg.Auth.Method, "auth cannot be used along with custom PerRPCCredentials", nil)
+		}
+	}
+
+	if cfg.Timeout < 0 {
+		invalid("timeout", cfg.Timeout.String(), "timeout cannot be negative", nil)
+	}
+
+	if cfg.Timeout > 0 && !cfg.Blocking {
+		invalid("timeout", cfg.Timeout.String(), "timeout is only valid when using a blocking connection", nil)
+	}
+
+	if cfg.KeepAliveInterval < 0 {
+		invalid("keepAlive.interval", cfg.KeepAliveInterval.String(), "keepAlive.interval cannot be negative", nil)
+	}
+
+	if cfg.KeepAliveTimeout < 0 {
+		invalid("keepAlive.timeout", cfg.KeepAliveTimeout.String(), "keepAlive.timeout cannot be negative", nil)
+	}
+
+	sizes := []struct {
+		option string
+		value  int64
+		min    int64
+	}{
+		{"maxRecvMsgSize", int64(cfg.MaxRecvMsgSize), 0},
+		{"maxSendMsgSize", int64(cfg.MaxSendMsgSize), 0},
+		{"initialWindowSize", int64(cfg.InitialWindowSize), minWindowSize},
+		{"initialConnWindowSize", int64(cfg.InitialConnWindowSize), minWindowSize},
+		{"readBufferSize", int64(cfg.ReadBufferSize), 0},
+		{"writeBufferSize", int64(cfg.WriteBufferSize), 0},
+	}
+
+	for _, size := range sizes {
+		switch {
+		case size.value < 0:
+			invalid(size.option, strconv.FormatInt(size.value, 10), "size cannot be negative", nil)
+		case size.value > 0 && size.value < size.min:
+			invalid(size.option, strconv.FormatInt(size.value, 10), fmt.Sprintf("size must be at least %d bytes", size.min), nil)
+		}
+	}
+
+	if cfg.Compressor != "" && encoding.GetCompressor(cfg.Compressor) == nil {
+		invalid("compressor", cfg.Compressor, "unknown compressor", nil)
+	}
+
+	if cfg.PoolSize < 0 {
+		invalid("pool", strconv.Itoa(cfg.PoolSize), "pool cannot be negative", nil)
+	}
+
+	if cfg.PoolStrategy != "" && !cfg.PoolStrategy.valid() {
+		invalid("pool.strategy", string(cfg.PoolStrategy), "unknown pool strategy", nil)
+	}
+
+	if cfg.PoolMaxConnectionAge < 0 {
+		invalid("pool.maxConnectionAge", cfg.PoolMaxConnectionAge.String(), "pool.maxConnectionAge cannot be negative", nil)
+	}
+
+	if cfg.PoolMaxConnectionAgeJitter < 0 {
+		invalid("pool.maxConnectionAgeJitter", cfg.PoolMaxConnectionAgeJitter.String(), "pool.maxConnectionAgeJitter cannot be negative", nil)
+	} else if cfg.PoolMaxConnectionAgeJitter > 0 && cfg.PoolMaxConnectionAgeJitter >= cfg.PoolMaxConnectionAge {
+		invalid("pool.maxConnectionAgeJitter", cfg.PoolMaxConnectionAgeJitter.String(), "pool.maxConnectionAgeJitter must be lower than pool.maxConnectionAge", nil)
+	}
+
+	if _, err := cfg.ServiceConfig(); err != nil {
+		invalid("defaultServiceConfig", cfg.DefaultServiceConfig, err.Error(), err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyOptions applies the given set of connection string options to this
+// config and validates the result. Every problem found is reported, see
+// Validate.
+func (cfg *ClientConfig) applyOptions(q url.Values) error {
+	var errs []error
+
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		parser, ok := clientOptionsParsers[k]
+		if !ok {
+			errs = append(errs, &ClientOptionError{Option: k, Value: q.Get(k), Reason: "unknown grpc client option"})
+
+			continue
+		}
+
+		values, err := interpolateOption(k, q[k])
+		if err != nil {
+			errs = append(errs, newClientOptionError(k, q.Get(k), err))
+
+			continue
+		}
+
+		if err := parser(cfg, values[0], values...); err != nil {
+			errs = append(errs, newClientOptionError(k, q.Get(k), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if cfg.Auth != nil && cfg.Auth.Method == "" {
+		cfg.Auth.Method = inferAuthMethod(cfg.Auth)
+	}
+
+	// The default timeout only makes sense for blocking connections.
+	if !cfg.Blocking && !q.Has("timeout") {
+		cfg.Timeout = 0
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.loadTLSKeyPair(); err != nil {
+		return newClientOptionError("tls.cert", cfg.TLSCertFile, err)
+	}
+
+	return nil
+}
+
+// splitJoinedError returns the list of errors joined into the given error
+// (see errors.Join), or the error itself if it is not a joined error.
+func splitJoinedError(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		if _, isOptErr := err.(*ClientOptionError); !isOptErr {
+			return joined.Unwrap()
+		}
+	}
+
+	return []error{err}
+}
+
+// tlsOptionsValue represents the TLS version and cipher suite options of
+// this config, used when reporting TLS errors.
+func (cfg ClientConfig) tlsOptionsValue() string {
+	q := cfg.options(true)
+	values := url.Values{}
+
+	for _, k := range []string{"tls.minVersion", "tls.maxVersion", "tls.cipherSuites"} {
+		if v, ok := q[k]; ok {
+			values[k] = v
+		}
+	}
+
+	value, _ := url.QueryUnescape(values.Encode())
+
+	return value
+}
@@ -0,0 +1,65 @@
+package grpcx_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+)
+
+func TestClientConfig_Validate(t *testing.T) {
+	t.Run("it should accept a valid config", func(t *testing.T) {
+		cfg := grpcx.ClientConfig{Host: "example.com", Port: 443, Blocking: true, Timeout: time.Second}
+
+		require.NoError(t, cfg.Validate())
+	})
+
+	t.Run("it should report every problem at once", func(t *testing.T) {
+		cfg := grpcx.ClientConfig{
+			Host:     "example.com",
+			Port:     0,
+			Insecure: true,
+			TLS:      &tls.Config{ServerName: "example.com"},
+			Timeout:  5 * time.Second,
+			Blocking: false,
+		}
+
+		err := cfg.Validate()
+		require.ErrorIs(t, err, grpcx.ErrInvalidClientConnectionString)
+		require.ElementsMatch(t, []string{"port", "tls", "timeout"}, optionErrorNames(err))
+	})
+}
+
+func TestParseClientConfig_ReportsEveryError(t *testing.T) {
+	_, err := grpcx.ParseClientConfig("grpc://example.com:443?timeout=xxx&tls=maybe&unknown=1&pool=-1")
+	require.ErrorIs(t, err, grpcx.ErrInvalidClientConnectionString)
+	require.ElementsMatch(t, []string{"timeout", "tls", "unknown", "pool"}, optionErrorNames(err))
+
+	var optErr *grpcx.ClientOptionError
+
+	require.ErrorAs(t, err, &optErr)
+	require.NotEmpty(t, optErr.Reason)
+}
+
+// optionErrorNames returns the option names of every ClientOptionError joined
+// into the given error.
+func optionErrorNames(err error) []string {
+	var names []string
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil
+	}
+
+	for _, e := range joined.Unwrap() {
+		var optErr *grpcx.ClientOptionError
+		if errors.As(e, &optErr) {
+			names = append(names, optErr.Option)
+		}
+	}
+
+	return names
+}
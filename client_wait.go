@@ -0,0 +1,163 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+)
+
+// DialError is returned when a connection does not become ready, it carries
+// the last failure observed while connecting (connection refused, TLS
+// handshake errors, etc.) so startup failures can be diagnosed.
+type DialError struct {
+	// Target is the dialed target.
+	Target string
+
+	// State is the connectivity state of the connection when giving up.
+	State connectivity.State
+
+	// Err is the reason to give up waiting, usually a context error.
+	Err error
+
+	// LastErr is the last failure observed while connecting, if any. Dial
+	// failures are not observed when connections go through the proxy given
+	// by the HTTPS_PROXY environment variable, only handshake failures are.
+	LastErr error
+}
+
+func (e *DialError) Error() string {
+	if e.LastErr == nil {
+		return fmt.Sprintf("could not connect to `%s`, state = %s, details = %s", e.Target, e.State, e.Err)
+	}
+
+	return fmt.Sprintf("could not connect to `%s`, state = %s, details = %s, last error = %s", e.Target, e.State, e.Err, e.LastErr)
+}
+
+// Unwrap returns the reason to give up waiting along with the last failure,
+// so both can be matched using errors.Is and errors.As.
+func (e *DialError) Unwrap() []error {
+	var errs []error
+
+	for _, err := range []error{e.Err, e.LastErr} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// DialAndWait dials the backend and waits until the connection is ready,
+// watching its connectivity state regardless of the ClientConfig.Blocking
+// setting. The wait is bounded by the given context and by
+// ClientConfig.Timeout, if set.
+//
+// If the connection does not become ready, it is closed and a *DialError is
+// returned carrying the last failure observed while connecting.
+func (d *Dialer) DialAndWait(ctx context.Context) (*grpc.ClientConn, error) {
+	conn, failures, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if d.cfg.Timeout > 0 {
+		c, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+		defer cancel()
+
+		ctx = c
+	}
+
+	if state, wErr := waitForReady(ctx, conn); wErr != nil {
+		_ = conn.Close()
+
+		return nil, &DialError{
+			Target:  conn.Target(),
+			State:   state,
+			Err:     wErr,
+			LastErr: failures.last(),
+		}
+	}
+
+	return conn, nil
+}
+
+// waitForReady connects the given connection and blocks until it is ready or
+// the context is done, returning the last observed state.
+func waitForReady(ctx context.Context, conn *grpc.ClientConn) (connectivity.State, error) {
+	conn.Connect()
+
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return state, nil
+		}
+
+		if !conn.WaitForStateChange(ctx, state) {
+			return state, ctx.Err()
+		}
+	}
+}
+
+// dialFailures records the last failure observed while connecting.
+type dialFailures struct {
+	mu  sync.Mutex
+	err error
+}
+
+// record stores the given error, cancellations are ignored as they are caused
+// by the connection being closed.
+func (f *dialFailures) record(err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = err
+}
+
+func (f *dialFailures) last() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+// contextDialer wraps the given dialer so its failures are recorded.
+func (f *dialFailures) contextDialer(dial func(ctx context.Context, addr string) (net.Conn, error)) func(ctx context.Context, addr string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, addr)
+		if err != nil {
+			f.record(err)
+		}
+
+		return conn, err
+	}
+}
+
+// recordingCredentials wraps transport credentials so handshake failures are
+// recorded.
+type recordingCredentials struct {
+	credentials.TransportCredentials
+	failures *dialFailures
+}
+
+func (c *recordingCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		c.failures.record(fmt.Errorf("%s handshake with `%s` failed, details = %w", c.Info().SecurityProtocol, authority, err))
+	}
+
+	return conn, info, err
+}
+
+func (c *recordingCredentials) Clone() credentials.TransportCredentials {
+	return &recordingCredentials{TransportCredentials: c.TransportCredentials.Clone(), failures: c.failures}
+}
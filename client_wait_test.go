@@ -0,0 +1,78 @@
+package grpcx_test
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestDialer_DialAndWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("it should return a ready connection", func(t *testing.T) {
+		addr, _ := startTestServer(t, "127.0.0.1:0")
+
+		cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&blocking=false")
+		require.NoError(t, err)
+
+		conn, err := cfg.NewDialer().DialAndWait(ctx)
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		require.Equal(t, connectivity.Ready, conn.GetState())
+
+		_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	})
+
+	t.Run("it should report refused connections", func(t *testing.T) {
+		addr := closedTestAddr(t)
+
+		cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&timeout=500ms")
+		require.NoError(t, err)
+
+		_, err = cfg.NewDialer().DialAndWait(ctx)
+
+		var dialErr *grpcx.DialError
+		require.ErrorAs(t, err, &dialErr)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorIs(t, err, syscall.ECONNREFUSED)
+		require.NotEqual(t, connectivity.Ready, dialErr.State)
+		require.Contains(t, dialErr.Target, addr)
+	})
+
+	t.Run("it should report TLS handshake failures", func(t *testing.T) {
+		addr, _ := startTestServer(t, "127.0.0.1:0")
+
+		cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=true&timeout=500ms")
+		require.NoError(t, err)
+
+		_, err = cfg.NewDialer().Dial(ctx)
+
+		var dialErr *grpcx.DialError
+		require.ErrorAs(t, err, &dialErr)
+		require.Error(t, dialErr.LastErr)
+		require.Contains(t, dialErr.LastErr.Error(), "tls handshake")
+	})
+
+	t.Run("it should stop waiting when the context is done", func(t *testing.T) {
+		addr := closedTestAddr(t)
+
+		cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&blocking=false")
+		require.NoError(t, err)
+
+		c, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err = cfg.NewDialer().DialAndWait(c)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
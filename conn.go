@@ -2,10 +2,18 @@ package grpcx
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
 )
 
 // ClientConn is an abstraction for grpc.ClientConn.
@@ -14,25 +22,465 @@ type ClientConn interface {
 	io.Closer
 }
 
-type connPoolRoundRobin struct {
-	conns    []*grpc.ClientConn
-	balancer *Balancer[*grpc.ClientConn]
+// ClientConnPool is a ClientConn backed by a pool of grpc.ClientConn
+// instances.
+//
+// Once closed, or while shutting down, new calls fail with codes.Canceled.
+// Close closes every connection immediately, aborting in-flight calls and
+// streams, while Shutdown waits for them to finish first.
+type ClientConnPool interface {
+	ClientConn
+
+	// Shutdown stops accepting new calls and waits for in-flight unary calls
+	// and open streams to finish before closing every connection. If the
+	// context is done first, connections are closed anyway and the context
+	// error is returned along with any close error.
+	Shutdown(ctx context.Context) error
+}
+
+// errClientConnPoolClosing is returned by calls made to a pool that is closed
+// or shutting down.
+var errClientConnPoolClosing = status.Error(codes.Canceled, "grpc conn pool: the connection pool is closing")
+
+type connPool struct {
+	balancer *Balancer[*poolMember]
+	strategy PoolStrategy
+
+	// dialer is used to replace members that are shut down, nil if members
+	// cannot be replaced.
+	dialer *Dialer
+
+	mu      sync.Mutex
+	members []*poolMember
+	closed  bool
+
+	// closing is set once the pool stops accepting new calls.
+	closing atomic.Bool
+
+	// ctx is canceled when the pool is closed, stopping its background work
+	// which is tracked by wg.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// outstanding is the number of in-flight unary calls and open streams of
+	// the whole pool.
+	outstanding atomic.Int64
+
+	// autoScaling is nil unless the pool grows and shrinks with its load,
+	// between minSize and autoScaling.MaxSize members. scaling is set while a
+	// member is being added.
+	autoScaling *AutoScaling
+	minSize     int
+	scaling     atomic.Bool
+
+	// maxAge is the age after which members are replaced, give or take
+	// maxAgeJitter. Zero means members are never replaced because of their
+	// age.
+	maxAge       time.Duration
+	maxAgeJitter time.Duration
+}
+
+// poolMember is a connection of a pool along with its last known
+// connectivity state and its number of in-flight unary calls and open
+// streams.
+type poolMember struct {
+	conn        *grpc.ClientConn
+	state       atomic.Int32
+	outstanding atomic.Int64
+
+	// lastUsed is the time, in Unix nanoseconds, a call was last started or
+	// finished using the member.
+	lastUsed atomic.Int64
+
+	// retired is set once the member is removed from the pool, so it is not
+	// replaced again.
+	retired atomic.Bool
+}
+
+// healthy tells whether calls can be routed to the member.
+func (m *poolMember) healthy() bool {
+	state := connectivity.State(m.state.Load())
+
+	return state == connectivity.Ready || state == connectivity.Idle
 }
 
 // NewClientConnPool returns a new instance of ClientConn that uses a pool of
 // grpc.ClientConn instances when calling Invoke and NewStream using a round-robin
 // strategy.
 //
+// The connectivity state of each connection is tracked, calls are routed only
+// to READY or IDLE connections, or to any connection when none of them is.
+//
 // The returned ClientConn is safe for concurrent use by multiple goroutines.
-func NewClientConnPool(conns ...*grpc.ClientConn) ClientConn {
-	return &connPoolRoundRobin{
-		conns:    conns,
-		balancer: NewBalancer[*grpc.ClientConn](conns...),
+func NewClientConnPool(conns ...*grpc.ClientConn) ClientConnPool {
+	return NewClientConnPoolWithStrategy(PoolStrategyRoundRobin, conns...)
+}
+
+// NewClientConnPoolWithStrategy same as NewClientConnPool but distributes calls
+// among connections using the given strategy. Unknown strategies fall back to
+// PoolStrategyRoundRobin.
+func NewClientConnPoolWithStrategy(strategy PoolStrategy, conns ...*grpc.ClientConn) ClientConnPool {
+	cp := newConnPool(nil, strategy)
+
+	for _, conn := range conns {
+		cp.add(conn)
+	}
+
+	return cp
+}
+
+// newConnPool builds an empty pool using the given strategy, the given dialer
+// is used to replace members that are shut down, if not nil.
+func newConnPool(dialer *Dialer, strategy PoolStrategy) *connPool {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &connPool{
+		balancer: NewBalancer[*poolMember](),
+		strategy: strategy,
+		dialer:   dialer,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// add adds the given connection to the pool. It returns false if the pool is
+// already closed, in which case the caller is responsible for closing the
+// connection.
+func (cp *connPool) add(conn *grpc.ClientConn) bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if cp.closed {
+		return false
+	}
+
+	// The balancer keeps using the previous slice, so it must not be written
+	// in place.
+	cp.members = append(cp.members[:len(cp.members):len(cp.members)], cp.watch(conn))
+	cp.balancer.Update(cp.members...)
+
+	return true
+}
+
+// swap replaces the given member with a new connection. It returns false if
+// the pool is already closed or the member is no longer part of it, in which
+// case the caller is responsible for closing the connection.
+func (cp *connPool) swap(old *poolMember, conn *grpc.ClientConn) bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if cp.closed {
+		return false
+	}
+
+	members := make([]*poolMember, 0, len(cp.members))
+
+	for _, m := range cp.members {
+		if m != old {
+			members = append(members, m)
+		}
+	}
+
+	if len(members) == len(cp.members) {
+		return false
+	}
+
+	old.retired.Store(true)
+	cp.members = append(members, cp.watch(conn))
+	cp.balancer.Update(cp.members...)
+
+	return true
+}
+
+// watch builds a member for the given connection and tracks its state until
+// the pool is closed. Members that are shut down are replaced when the pool
+// has a dialer. Must be called with the pool lock held.
+func (cp *connPool) watch(conn *grpc.ClientConn) *poolMember {
+	m := &poolMember{conn: conn}
+	state := conn.GetState()
+	m.state.Store(int32(state))
+	m.lastUsed.Store(time.Now().UnixNano())
+
+	cp.wg.Add(1)
+
+	go func() {
+		defer cp.wg.Done()
+
+		for state != connectivity.Shutdown && conn.WaitForStateChange(cp.ctx, state) {
+			state = conn.GetState()
+			m.state.Store(int32(state))
+		}
+
+		if state != connectivity.Shutdown || cp.dialer == nil || m.retired.Load() {
+			return
+		}
+
+		if replacement, ok := redial(cp.ctx, cp.dialer); ok && !cp.swap(m, replacement) {
+			_ = replacement.Close()
+		}
+	}()
+
+	if cp.maxAge > 0 && cp.dialer != nil {
+		cp.wg.Add(1)
+
+		go func() {
+			defer cp.wg.Done()
+
+			cp.expire(m)
+		}()
 	}
+
+	return m
 }
 
-func (cp *connPoolRoundRobin) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
-	err := cp.balancer.Next().Invoke(ctx, method, args, reply, opts...)
+// expire replaces the given member once it reaches its maximum age. The
+// replacement is dialed first, then swapped into the pool, and the member is
+// closed once its in-flight calls and streams finish.
+func (cp *connPool) expire(m *poolMember) {
+	age := cp.maxAge
+	if cp.maxAgeJitter > 0 {
+		age += time.Duration(rand.Int63n(2*int64(cp.maxAgeJitter)+1)) - cp.maxAgeJitter
+	}
+
+	timer := time.NewTimer(age)
+	defer timer.Stop()
+
+	select {
+	case <-cp.ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	if m.retired.Load() {
+		return
+	}
+
+	conn, ok := redial(cp.ctx, cp.dialer)
+	if !ok {
+		return
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if cp.closed || !cp.retire(m, conn) {
+		_ = conn.Close()
+	}
+}
+
+// retire removes the given member from the pool, along with adding the given
+// replacement connection if not nil. The member connection is closed once its
+// in-flight calls and streams finish. It returns false if the member is no
+// longer part of the pool. Must be called with the pool lock held.
+func (cp *connPool) retire(old *poolMember, replacement *grpc.ClientConn) bool {
+	members := make([]*poolMember, 0, len(cp.members))
+
+	for _, m := range cp.members {
+		if m != old {
+			members = append(members, m)
+		}
+	}
+
+	if len(members) == len(cp.members) {
+		return false
+	}
+
+	if replacement != nil {
+		members = append(members, cp.watch(replacement))
+	}
+
+	old.retired.Store(true)
+	cp.members = members
+	cp.balancer.Update(cp.members...)
+
+	cp.wg.Add(1)
+
+	go func() {
+		defer cp.wg.Done()
+
+		drain(cp.ctx, old)
+
+		_ = old.conn.Close()
+	}()
+
+	return true
+}
+
+// drain waits until the given retired member has no in-flight calls or open
+// streams, or the context is done. Calls picking the member once it is retired
+// do not use it, see begin.
+func drain(ctx context.Context, m *poolMember) {
+	ticker := time.NewTicker(poolDrainInterval)
+	defer ticker.Stop()
+
+	for m.outstanding.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// acquire accounts for a call or stream started using the given member,
+// growing the pool if needed.
+func (cp *connPool) acquire(m *poolMember) {
+	m.outstanding.Add(1)
+	m.lastUsed.Store(time.Now().UnixNano())
+
+	total := cp.outstanding.Add(1)
+
+	if cp.autoScaling != nil {
+		cp.scaleUp(total)
+	}
+}
+
+// release accounts for a call or stream finished using the given member.
+func (cp *connPool) release(m *poolMember) {
+	m.outstanding.Add(-1)
+	m.lastUsed.Store(time.Now().UnixNano())
+	cp.outstanding.Add(-1)
+}
+
+// scaleUp adds a member to the pool in the background when the given number
+// of in-flight calls and streams exceeds the per connection threshold, unless
+// the pool is at its maximum size or already growing.
+func (cp *connPool) scaleUp(outstanding int64) {
+	size := cp.balancer.Len()
+	if size >= cp.autoScaling.MaxSize || outstanding <= int64(size*cp.autoScaling.StreamsPerConn) {
+		return
+	}
+
+	if !cp.scaling.CompareAndSwap(false, true) {
+		return
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if cp.closed {
+		return
+	}
+
+	cp.wg.Add(1)
+
+	go func() {
+		defer cp.wg.Done()
+		defer cp.scaling.Store(false)
+
+		if conn, ok := redial(cp.ctx, cp.dialer); ok && !cp.add(conn) {
+			_ = conn.Close()
+		}
+	}()
+}
+
+// scaleDown periodically retires members that have been idle for longer than
+// the cool-down period, while the pool is above its minimum size.
+func (cp *connPool) scaleDown() {
+	defer cp.wg.Done()
+
+	ticker := time.NewTicker(cp.autoScaling.CoolDown / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cp.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		idleSince := time.Now().Add(-cp.autoScaling.CoolDown).UnixNano()
+
+		cp.mu.Lock()
+
+		for _, m := range cp.members {
+			if len(cp.members) <= cp.minSize {
+				break
+			}
+
+			if m.outstanding.Load() == 0 && m.lastUsed.Load() <= idleSince {
+				cp.retire(m, nil)
+			}
+		}
+
+		cp.mu.Unlock()
+	}
+}
+
+// pick returns the member to route a call to according to the pool strategy.
+// Only healthy members are considered, unless none of them is.
+func (cp *connPool) pick() (*poolMember, error) {
+	members, start := cp.balancer.next()
+	if len(members) == 0 {
+		return nil, status.Error(codes.Unavailable, "grpc conn pool: no connections available")
+	}
+
+	for _, healthyOnly := range []bool{true, false} {
+		var best *poolMember
+
+		// Members are visited in round-robin order, so ties are broken
+		// evenly.
+		for i := range members {
+			m := members[(start+i)%len(members)]
+			if healthyOnly && !m.healthy() {
+				continue
+			}
+
+			if cp.strategy != PoolStrategyLeastOutstanding {
+				return m, nil
+			}
+
+			if best == nil || m.outstanding.Load() < best.outstanding.Load() {
+				best = m
+			}
+		}
+
+		if best != nil {
+			return best, nil
+		}
+	}
+
+	return members[start], nil
+}
+
+// begin picks a member for a new call or stream and accounts for it, it fails
+// if the pool stopped accepting new calls. Calls are accounted for before
+// checking the pool and member state, so Shutdown and drain either wait for
+// them or they are rejected. Members retired in the meantime are replaced by
+// another pick.
+func (cp *connPool) begin() (*poolMember, error) {
+	for {
+		m, err := cp.pick()
+		if err != nil {
+			return nil, err
+		}
+
+		cp.acquire(m)
+
+		if cp.closing.Load() {
+			cp.release(m)
+
+			return nil, errClientConnPoolClosing
+		}
+
+		if !m.retired.Load() {
+			return m, nil
+		}
+
+		cp.release(m)
+	}
+}
+
+func (cp *connPool) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	m, err := cp.begin()
+	if err != nil {
+		return err
+	}
+
+	defer cp.release(m)
+
+	err = m.conn.Invoke(ctx, method, args, reply, opts...)
 
 	if err != nil {
 		return err
@@ -41,22 +489,65 @@ func (cp *connPoolRoundRobin) Invoke(ctx context.Context, method string, args in
 	return nil
 }
 
-func (cp *connPoolRoundRobin) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
-	stream, err := cp.balancer.Next().NewStream(ctx, desc, method, opts...)
+func (cp *connPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	m, err := cp.begin()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := m.conn.NewStream(ctx, desc, method, opts...)
 
 	if err != nil {
+		cp.release(m)
+
 		return nil, err
 	}
 
+	// The stream context is canceled once the stream finishes, either
+	// successfully or not.
+	context.AfterFunc(stream.Context(), func() {
+		cp.release(m)
+	})
+
 	return stream, nil
 }
 
-func (cp *connPoolRoundRobin) Close() error {
-	for i, conn := range cp.conns {
-		if err := conn.Close(); err != nil {
-			log.Printf("%s: grpc conn pool warning, failed to close connection %d", err, i)
+func (cp *connPool) Shutdown(ctx context.Context) error {
+	cp.closing.Store(true)
+
+	ticker := time.NewTicker(poolDrainInterval)
+	defer ticker.Stop()
+
+	for cp.outstanding.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), cp.Close())
+		case <-ticker.C:
 		}
 	}
 
-	return nil
+	return cp.Close()
+}
+
+func (cp *connPool) Close() error {
+	cp.closing.Store(true)
+
+	cp.mu.Lock()
+	cp.closed = true
+	members := cp.members
+	cp.members = nil
+	cp.mu.Unlock()
+
+	cp.cancel()
+	cp.wg.Wait()
+
+	var errs []error
+
+	for i, m := range members {
+		if err := m.conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("could not close connection %d of the pool, details = %w", i, err))
+		}
+	}
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,296 @@
+package grpcx_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientConnPool_SkipsBrokenMembers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	addr, _ := startTestServer(t, "127.0.0.1:0")
+
+	healthy, err := grpc.NewClient("passthrough:///"+addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+
+	broken, err := grpc.NewClient("passthrough:///"+closedTestAddr(t), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = healthy.Close()
+		_ = broken.Close()
+	})
+
+	broken.Connect()
+
+	require.Eventually(t, func() bool {
+		return broken.GetState() == connectivity.TransientFailure
+	}, 5*time.Second, 10*time.Millisecond)
+
+	t.Run("it should route calls to healthy members only", func(t *testing.T) {
+		pool := grpcx.NewClientConnPool(broken, healthy)
+		client := grpc_health_v1.NewHealthClient(pool)
+
+		for i := 0; i < 10; i++ {
+			_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("it should fall back to any member when none is healthy", func(t *testing.T) {
+		pool := grpcx.NewClientConnPool(broken)
+
+		_, err = grpc_health_v1.NewHealthClient(pool).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.Equal(t, codes.Unavailable, status.Code(err))
+	})
+
+	t.Run("it should fail when the pool is empty", func(t *testing.T) {
+		_, err = grpc_health_v1.NewHealthClient(grpcx.NewClientConnPool()).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.Equal(t, codes.Unavailable, status.Code(err))
+	})
+}
+
+func TestClientConnPool_ReplacesShutdownMembers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	addr, _ := startTestServer(t, "127.0.0.1:0")
+
+	cfg, err := grpcx.ParseClientConfig("grpc://" + addr + "?tls=false&timeout=5s")
+	require.NoError(t, err)
+
+	var (
+		mu   sync.Mutex
+		used *grpc.ClientConn
+	)
+
+	// Captures the member used by the last call, so it can be closed behind
+	// the pool's back.
+	capture := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		mu.Lock()
+		used = cc
+		mu.Unlock()
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	rec := &stateRecorder{}
+
+	pool, err := cfg.NewDialer().WithUnaryInterceptors(capture).OnStateChange(rec.record).DialPool(ctx, 2)
+	require.NoError(t, err)
+
+	defer pool.Close()
+
+	client := grpc_health_v1.NewHealthClient(pool)
+
+	_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	mu.Lock()
+	require.NoError(t, used.Close())
+	mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		return rec.reached(connectivity.Ready) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	}
+}
+
+// closedTestAddr returns a local address nobody listens on.
+func closedTestAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	return addr
+}
+
+func TestClientConnPool_LeastOutstanding(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	addr, _ := startTestServer(t, "127.0.0.1:0")
+
+	var (
+		mu    sync.Mutex
+		unary []*grpc.ClientConn
+	)
+
+	record := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		mu.Lock()
+		unary = append(unary, cc)
+		mu.Unlock()
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	conns := make([]*grpc.ClientConn, 2)
+
+	for i := range conns {
+		conn, err := grpc.NewClient("passthrough:///"+addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(record))
+		require.NoError(t, err)
+
+		conns[i] = conn
+	}
+
+	pool := grpcx.NewClientConnPoolWithStrategy(grpcx.PoolStrategyLeastOutstanding, conns...)
+	defer pool.Close()
+
+	client := grpc_health_v1.NewHealthClient(pool)
+
+	// checkTimes sends the given number of sequential unary calls, returning
+	// the connections used.
+	checkTimes := func(n int) map[*grpc.ClientConn]int {
+		mu.Lock()
+		unary = nil
+		mu.Unlock()
+
+		for i := 0; i < n; i++ {
+			_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+			require.NoError(t, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		used := make(map[*grpc.ClientConn]int)
+		for _, cc := range unary {
+			used[cc]++
+		}
+
+		return used
+	}
+
+	t.Run("it should avoid connections with open streams", func(t *testing.T) {
+		streamCtx, stopStream := context.WithCancel(ctx)
+
+		watch, err := client.Watch(streamCtx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+
+		_, err = watch.Recv()
+		require.NoError(t, err)
+
+		used := checkTimes(6)
+		require.Len(t, used, 1)
+
+		stopStream()
+
+		require.Eventually(t, func() bool {
+			return len(checkTimes(2)) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestClientConnPool_Close(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	addr, _ := startTestServer(t, "127.0.0.1:0")
+
+	newConns := func(n int) []*grpc.ClientConn {
+		conns := make([]*grpc.ClientConn, n)
+
+		for i := range conns {
+			conn, err := grpc.NewClient("passthrough:///"+addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			require.NoError(t, err)
+
+			conns[i] = conn
+		}
+
+		return conns
+	}
+
+	t.Run("it should report connections that fail to close", func(t *testing.T) {
+		conns := newConns(2)
+		require.NoError(t, conns[1].Close())
+
+		pool := grpcx.NewClientConnPool(conns...)
+
+		err := pool.Close()
+		require.ErrorContains(t, err, "connection 1")
+		require.NotContains(t, err.Error(), "connection 0")
+
+		_, err = grpc_health_v1.NewHealthClient(pool).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.Equal(t, codes.Canceled, status.Code(err))
+	})
+
+	t.Run("it should wait for open streams when shutting down", func(t *testing.T) {
+		pool := grpcx.NewClientConnPool(newConns(2)...)
+		client := grpc_health_v1.NewHealthClient(pool)
+
+		streamCtx, stopStream := context.WithCancel(ctx)
+		defer stopStream()
+
+		watch, err := client.Watch(streamCtx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+
+		_, err = watch.Recv()
+		require.NoError(t, err)
+
+		done := make(chan error, 1)
+
+		go func() {
+			done <- pool.Shutdown(ctx)
+		}()
+
+		require.Eventually(t, func() bool {
+			_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+
+			return status.Code(err) == codes.Canceled
+		}, 5*time.Second, 10*time.Millisecond)
+
+		select {
+		case err = <-done:
+			t.Fatalf("shutdown returned before the stream finished, err = %v", err)
+		case <-time.After(300 * time.Millisecond):
+		}
+
+		require.NoError(t, watch.Context().Err())
+
+		stopStream()
+
+		select {
+		case err = <-done:
+			require.NoError(t, err)
+		case <-ctx.Done():
+			t.Fatal("shutdown did not return after the stream finished")
+		}
+	})
+
+	t.Run("it should close connections when the shutdown context is done", func(t *testing.T) {
+		pool := grpcx.NewClientConnPool(newConns(1)...)
+
+		watch, err := grpc_health_v1.NewHealthClient(pool).Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+
+		_, err = watch.Recv()
+		require.NoError(t, err)
+
+		shutdownCtx, cancelShutdown := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancelShutdown()
+
+		require.ErrorIs(t, pool.Shutdown(shutdownCtx), context.DeadlineExceeded)
+
+		_, err = watch.Recv()
+		require.Equal(t, codes.Canceled, status.Code(err))
+	})
+}
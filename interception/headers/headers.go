@@ -42,3 +42,51 @@ func StreamClientInterceptor(headers map[string]string) grpc.StreamClientInterce
 		return s, err
 	}
 }
+
+// HeadersFunc returns the list of headers to be injected into an outgoing
+// request. It is called once per request.
+type HeadersFunc func(ctx context.Context) (map[string]string, error)
+
+// UnaryClientInterceptorFunc same as UnaryClientInterceptor, but headers are
+// obtained from the given function on every request, so they may change over
+// time, e.g. rotated authentication tokens. If the function fails the request
+// is aborted and the error returned to the caller.
+func UnaryClientInterceptorFunc(fn HeadersFunc) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		kvs, err := headerPairs(ctx, fn)
+		if err != nil {
+			return err
+		}
+
+		ctx = metadata.AppendToOutgoingContext(ctx, kvs...)
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptorFunc similar to UnaryClientInterceptorFunc, but for
+// streaming requests.
+func StreamClientInterceptorFunc(fn HeadersFunc) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		kvs, err := headerPairs(ctx, fn)
+		if err != nil {
+			return nil, err
+		}
+
+		return streamer(metadata.AppendToOutgoingContext(ctx, kvs...), desc, cc, method, opts...)
+	}
+}
+
+func headerPairs(ctx context.Context, fn HeadersFunc) ([]string, error) {
+	headers, err := fn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := make([]string, 0, 2*len(headers))
+	for k, v := range headers {
+		kvs = append(kvs, k, v)
+	}
+
+	return kvs, nil
+}
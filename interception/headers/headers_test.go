@@ -2,6 +2,7 @@ package headers_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -82,3 +83,50 @@ func TestStreamClientInterceptor(t *testing.T) {
 		require.EqualValues(t, v, sentMD.Get(k)[0])
 	}
 }
+
+func TestUnaryClientInterceptorFunc(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	token := "first"
+	sentMD := metadata.MD{}
+
+	interceptor := headers.UnaryClientInterceptorFunc(func(ctx context.Context) (map[string]string, error) {
+		return map[string]string{"authorization": token}, nil
+	})
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sentMD, _ = metadata.FromOutgoingContext(ctx)
+
+		return nil
+	}
+
+	require.NoError(t, interceptor(ctx, "grpc.test.method", nil, nil, nil, invoker))
+	require.Equal(t, []string{"first"}, sentMD.Get("authorization"))
+
+	token = "second"
+
+	require.NoError(t, interceptor(ctx, "grpc.test.method", nil, nil, nil, invoker))
+	require.Equal(t, []string{"second"}, sentMD.Get("authorization"))
+}
+
+func TestStreamClientInterceptorFunc(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	stubErr := errors.New("token unavailable")
+	invokesCalls := counter.NewUnsigned()
+
+	interceptor := headers.StreamClientInterceptorFunc(func(ctx context.Context) (map[string]string, error) {
+		return nil, stubErr
+	})
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		invokesCalls.Add(1)
+
+		return nil, nil
+	}
+
+	_, err := interceptor(ctx, nil, nil, "grpc.test.method", streamer)
+
+	require.ErrorIs(t, err, stubErr)
+	require.EqualValues(t, 0, invokesCalls.Get())
+}
@@ -0,0 +1,242 @@
+package grpcx
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"gopkg.in/yaml.v3"
+)
+
+// FileResolverScheme is the scheme of the resolver that reads backend
+// addresses from a file given by its absolute path, e.g.
+// `file:///etc/backends.json`. The file is
+// polled for changes, every change is pushed to the connection so backends
+// are rebalanced without restarts.
+//
+// Files can be written in either JSON or YAML, with the following layout:
+//
+//	addresses:
+//	  - 10.0.0.1:50051
+//	  - address: 10.0.0.2:50051
+//	    weight: 3
+//	    attributes:
+//	      zone: us-east-1a
+//
+// Weights, 1 by default, are attached to addresses (see AddressWeight) and
+// honoured by the WeightedRoundRobinBalancerName policy
+// (`defaultServiceConfig=lbp-grpcx_weighted_round_robin`). Attributes can be
+// read from resolver.Address.Attributes using AddressAttributeKey.
+//
+// Using a connection string:
+//
+//	grpc://?resolver.scheme=file&resolver.path=/etc/backends.json
+const FileResolverScheme = "file"
+
+// defaultFileResolverPollInterval is how often files are checked for changes
+// by the resolver registered under FileResolverScheme.
+const defaultFileResolverPollInterval = 5 * time.Second
+
+// AddressAttributeKey is the key of the attributes attached to addresses by
+// the file resolver, see FileResolverScheme.
+type AddressAttributeKey string
+
+func init() {
+	resolver.Register(NewFileResolverBuilder(FileResolverScheme, defaultFileResolverPollInterval))
+}
+
+// NewFileResolverBuilder builds a resolver.Builder for file resolvers (see
+// FileResolverScheme) under the given scheme, checking files for changes at
+// the given interval. Use it along with grpc.WithResolvers, or
+// resolver.Register, when a different polling interval is needed.
+func NewFileResolverBuilder(scheme string, pollInterval time.Duration) resolver.Builder {
+	return &fileResolverBuilder{scheme: scheme, pollInterval: pollInterval}
+}
+
+type fileResolverBuilder struct {
+	scheme       string
+	pollInterval time.Duration
+}
+
+func (b *fileResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	path := target.URL.Path
+	if path == "" {
+		path = target.URL.Opaque
+	}
+
+	if path == "" {
+		return nil, fmt.Errorf("file resolver: missing file path in target `%s`", target.URL.String())
+	}
+
+	r := &fileResolver{
+		path: path,
+		cc:   cc,
+		now:  make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	if err := r.resolve(); err != nil {
+		return nil, err
+	}
+
+	r.wg.Add(1)
+
+	go r.watch(b.pollInterval)
+
+	return r, nil
+}
+
+func (b *fileResolverBuilder) Scheme() string {
+	return b.scheme
+}
+
+// fileResolver pushes the addresses listed in a file to a connection,
+// re-reading the file whenever it changes. If the file cannot be read or
+// parsed, the last known addresses are kept.
+type fileResolver struct {
+	path  string
+	cc    resolver.ClientConn
+	stamp fileStamp
+
+	now  chan struct{}
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+func (r *fileResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+func (r *fileResolver) Close() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+
+	r.wg.Wait()
+}
+
+func (r *fileResolver) watch(interval time.Duration) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		case <-r.now:
+		}
+
+		info, err := os.Stat(r.path)
+		if err != nil {
+			continue
+		}
+
+		if info.ModTime().Equal(r.stamp.modTime) && info.Size() == r.stamp.size {
+			continue
+		}
+
+		_ = r.resolve()
+	}
+}
+
+// resolve reads the file and pushes its addresses to the connection, an error
+// is returned only if the file cannot be read or parsed.
+func (r *fileResolver) resolve() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("file resolver: %w", err)
+	}
+
+	addresses, err := readAddressFile(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.stamp = fileStamp{modTime: info.ModTime(), size: info.Size()}
+
+	if len(addresses) == 0 {
+		r.cc.ReportError(fmt.Errorf("file resolver: no addresses found in `%s`", r.path))
+
+		return nil
+	}
+
+	_ = r.cc.UpdateState(resolver.State{Addresses: addresses})
+
+	return nil
+}
+
+// addressFile is the layout of files read by the file resolver.
+type addressFile struct {
+	Addresses []addressFileEntry `yaml:"addresses"`
+}
+
+// addressFileEntry is a backend address, given either as a plain `host:port`
+// string or as an object.
+type addressFileEntry struct {
+	Address    string            `yaml:"address"`
+	Weight     uint32            `yaml:"weight"`
+	Attributes map[string]string `yaml:"attributes"`
+}
+
+func (e *addressFileEntry) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&e.Address)
+	}
+
+	type plain addressFileEntry
+
+	return value.Decode((*plain)(e))
+}
+
+// readAddressFile reads the list of addresses from the given file. As JSON is
+// a subset of YAML, both formats are parsed using the YAML decoder.
+func readAddressFile(path string) ([]resolver.Address, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("file resolver: %w", err)
+	}
+
+	var file addressFile
+	if err := yaml.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("file resolver: invalid file `%s`, details = %w", path, err)
+	}
+
+	addresses := make([]resolver.Address, 0, len(file.Addresses))
+
+	for i, entry := range file.Addresses {
+		if entry.Address == "" {
+			return nil, fmt.Errorf("file resolver: invalid file `%s`, address #%d is empty", path, i)
+		}
+
+		addr := resolver.Address{Addr: entry.Address}
+
+		if entry.Weight > 0 {
+			addr = withAddressWeight(addr, entry.Weight)
+		}
+
+		keys := make([]string, 0, len(entry.Attributes))
+		for k := range entry.Attributes {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			addr.Attributes = addr.Attributes.WithValue(AddressAttributeKey(k), entry.Attributes[k])
+		}
+
+		addresses = append(addresses, addr)
+	}
+
+	return addresses, nil
+}
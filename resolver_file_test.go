@@ -0,0 +1,191 @@
+package grpcx_test
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestFileResolver(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "backends.yaml", []byte(`
+addresses:
+  - 10.0.0.1:50051
+  - address: 10.0.0.2:50051
+    weight: 3
+    attributes:
+      zone: us-east-1a
+`))
+
+	cc := &fakeResolverClientConn{}
+	builder := grpcx.NewFileResolverBuilder("grpcx-test-file-unit", 10*time.Millisecond)
+
+	r, err := builder.Build(resolver.Target{URL: url.URL{Scheme: "grpcx-test-file-unit", Path: path}}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	state := cc.lastState()
+	require.Len(t, state.Addresses, 2)
+	require.Equal(t, "10.0.0.1:50051", state.Addresses[0].Addr)
+	require.EqualValues(t, 1, grpcx.AddressWeight(state.Addresses[0]))
+	require.Equal(t, "10.0.0.2:50051", state.Addresses[1].Addr)
+	require.EqualValues(t, 3, grpcx.AddressWeight(state.Addresses[1]))
+	require.Equal(t, "us-east-1a", state.Addresses[1].Attributes.Value(grpcx.AddressAttributeKey("zone")))
+
+	writeTestFile(t, dir, "backends.yaml", []byte(`{"addresses": ["10.0.0.3:50051"]}`))
+
+	require.Eventually(t, func() bool {
+		state := cc.lastState()
+
+		return len(state.Addresses) == 1 && state.Addresses[0].Addr == "10.0.0.3:50051"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = builder.Build(resolver.Target{URL: url.URL{Scheme: "grpcx-test-file-unit", Path: filepath.Join(dir, "missing.json")}}, cc, resolver.BuildOptions{})
+	require.Error(t, err)
+}
+
+func TestParseClientConfigDial_FileResolver(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resolver.Register(grpcx.NewFileResolverBuilder("grpcx-test-file", 10*time.Millisecond))
+
+	first := startNamedTestServer(t, "first")
+	second := startNamedTestServer(t, "second")
+
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "backends.json", []byte(`{"addresses": ["`+first+`"]}`))
+
+	conn, err := grpcx.ParseClientConfigDial(ctx, "grpc://?tls=false&resolver.scheme=grpcx-test-file&resolver.path="+path)
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "first"})
+	require.NoError(t, err)
+
+	writeTestFile(t, dir, "backends.json", []byte(`{"addresses": [{"address": "`+second+`"}]}`))
+
+	require.Eventually(t, func() bool {
+		_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "second"})
+
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+
+	_, err = grpcx.ParseClientConfig("grpc://?resolver.scheme=file&resolver.path=backends.json")
+	require.ErrorIs(t, err, grpcx.ErrInvalidClientConnectionString)
+}
+
+func TestParseClientConfigDial_FileResolverWeights(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resolver.Register(grpcx.NewFileResolverBuilder("grpcx-test-file-weights", 10*time.Millisecond))
+
+	heavy, heavyHits := startCountingTestServer(t)
+	light, lightHits := startCountingTestServer(t)
+
+	path := writeTestFile(t, t.TempDir(), "backends.json", []byte(`{"addresses": [{"address": "`+heavy+`", "weight": 3}, "`+light+`"]}`))
+
+	conn, err := grpcx.ParseClientConfigDial(ctx, "grpc://?tls=false&defaultServiceConfig=lbp-grpcx_weighted_round_robin&resolver.scheme=grpcx-test-file-weights&resolver.path="+path)
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	// Once both connections are ready, calls are split by weight.
+	require.Eventually(t, func() bool {
+		heavyHits.Store(0)
+		lightHits.Store(0)
+
+		for i := 0; i < 40; i++ {
+			if _, cErr := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); cErr != nil {
+				return false
+			}
+		}
+
+		return heavyHits.Load() == 30 && lightHits.Load() == 10
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// startCountingTestServer starts a server counting the unary calls it
+// receives.
+func startCountingTestServer(t *testing.T) (string, *atomic.Int64) {
+	hits := &atomic.Int64{}
+
+	addr, _ := startTestServer(t, "127.0.0.1:0", grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			hits.Add(1)
+
+			return handler(ctx, req)
+		},
+	))
+
+	return addr, hits
+}
+
+// startNamedTestServer starts a server whose health service only reports the
+// given service name as serving, so tests can tell backends apart.
+func startNamedTestServer(t *testing.T, name string) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	hs := health.NewServer()
+	hs.SetServingStatus(name, grpc_health_v1.HealthCheckResponse_SERVING)
+
+	srv := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, hs)
+
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+type fakeResolverClientConn struct {
+	resolver.ClientConn
+
+	mu     sync.Mutex
+	states []resolver.State
+}
+
+func (cc *fakeResolverClientConn) UpdateState(state resolver.State) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.states = append(cc.states, state)
+
+	return nil
+}
+
+func (cc *fakeResolverClientConn) ReportError(error) {}
+
+func (cc *fakeResolverClientConn) lastState() resolver.State {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if len(cc.states) == 0 {
+		return resolver.State{}
+	}
+
+	return cc.states[len(cc.states)-1]
+}
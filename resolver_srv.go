@@ -0,0 +1,203 @@
+package grpcx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// SRVResolverScheme is the scheme of the resolver that discovers backends
+// using DNS SRV records, re-resolving them periodically.
+//
+// The target names either a host, in which case the `_grpc._tcp.<host>`
+// record is looked up, or a full SRV record name starting with an
+// underscore. An optional authority selects the DNS server to query:
+//
+//	srv:///billing.internal
+//	srv://10.0.0.53:53/_api._tcp.billing.internal
+//
+// Only records of the lowest priority whose targets resolve are used. Record
+// weights are attached to addresses as is (see AddressWeight) and honoured by
+// the WeightedRoundRobinBalancerName policy
+// (`defaultServiceConfig=lbp-grpcx_weighted_round_robin`), so records with a
+// weight of zero are only used when no other record is available.
+// Note that the default authority of the connection is the target name, so
+// the `authority` or `tls.serverName` options are usually needed along with
+// TLS.
+//
+// Using a connection string:
+//
+//	grpc://billing.internal:443?resolver.scheme=srv
+//	grpc://?resolver.scheme=srv&resolver.authority=10.0.0.53&resolver.path=_api._tcp.billing.internal
+const SRVResolverScheme = "srv"
+
+// defaultSRVResolverInterval is how often records are re-resolved by the
+// resolver registered under SRVResolverScheme.
+const defaultSRVResolverInterval = 30 * time.Second
+
+// srvLookupTimeout is the maximum time spent resolving records.
+const srvLookupTimeout = 10 * time.Second
+
+func init() {
+	resolver.Register(NewSRVResolverBuilder(SRVResolverScheme, defaultSRVResolverInterval))
+}
+
+// NewSRVResolverBuilder builds a resolver.Builder for SRV resolvers (see
+// SRVResolverScheme) under the given scheme, re-resolving records at the given
+// interval. Use it along with grpc.WithResolvers, or resolver.Register, when a
+// different interval is needed.
+func NewSRVResolverBuilder(scheme string, interval time.Duration) resolver.Builder {
+	return &srvResolverBuilder{scheme: scheme, interval: interval}
+}
+
+type srvResolverBuilder struct {
+	scheme   string
+	interval time.Duration
+}
+
+func (b *srvResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	name := target.Endpoint()
+	if name == "" {
+		return nil, fmt.Errorf("srv resolver: missing record name in target `%s`", target.URL.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &srvResolver{
+		name:     name,
+		resolver: net.DefaultResolver,
+		cc:       cc,
+		ctx:      ctx,
+		cancel:   cancel,
+		now:      make(chan struct{}, 1),
+	}
+
+	if server := target.URL.Host; server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	r.wg.Add(1)
+
+	go r.watch(b.interval)
+
+	return r, nil
+}
+
+func (b *srvResolverBuilder) Scheme() string {
+	return b.scheme
+}
+
+// srvResolver pushes the addresses found in SRV records to a connection. If
+// records cannot be resolved, the last known addresses are kept.
+type srvResolver struct {
+	name     string
+	resolver *net.Resolver
+	cc       resolver.ClientConn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	now    chan struct{}
+	wg     sync.WaitGroup
+}
+
+func (r *srvResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+func (r *srvResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *srvResolver) watch(interval time.Duration) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	resolved := false
+
+	for {
+		addresses, err := r.lookup()
+
+		switch {
+		case err == nil:
+			resolved = true
+			_ = r.cc.UpdateState(resolver.State{Addresses: addresses})
+		case !resolved && r.ctx.Err() == nil:
+			r.cc.ReportError(err)
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.now:
+		}
+	}
+}
+
+// lookup resolves the SRV records and the addresses of their targets.
+func (r *srvResolver) lookup() ([]resolver.Address, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, srvLookupTimeout)
+	defer cancel()
+
+	service, proto, name := "grpc", "tcp", r.name
+	if strings.HasPrefix(name, "_") {
+		service, proto = "", ""
+	} else if host, _, err := net.SplitHostPort(name); err == nil {
+		name = host
+	}
+
+	_, records, err := r.resolver.LookupSRV(ctx, service, proto, name)
+	if err != nil {
+		return nil, fmt.Errorf("srv resolver: %w", err)
+	}
+
+	// Records are sorted by priority, the first group with at least one
+	// resolvable target is used.
+	for i := 0; i < len(records); {
+		var addresses []resolver.Address
+
+		j := i
+		for ; j < len(records) && records[j].Priority == records[i].Priority; j++ {
+			hosts, hErr := r.resolver.LookupHost(ctx, records[j].Target)
+			if hErr != nil {
+				continue
+			}
+
+			for _, host := range hosts {
+				addr := resolver.Address{Addr: net.JoinHostPort(host, strconv.Itoa(int(records[j].Port)))}
+				addresses = append(addresses, withAddressWeight(addr, uint32(records[j].Weight)))
+			}
+		}
+
+		if len(addresses) > 0 {
+			return addresses, nil
+		}
+
+		i = j
+	}
+
+	return nil, fmt.Errorf("srv resolver: no resolvable targets found for `%s`", r.name)
+}
@@ -0,0 +1,236 @@
+package grpcx_test
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tangelo-labs/go-grpcx"
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestSRVResolver(t *testing.T) {
+	dns := startTestDNSServer(t)
+	dns.setSRV("_grpc._tcp.billing.test.",
+		dnsmessage.SRVResource{Priority: 10, Weight: 5, Port: 50051, Target: dnsmessage.MustNewName("a.billing.test.")},
+		dnsmessage.SRVResource{Priority: 20, Weight: 1, Port: 50052, Target: dnsmessage.MustNewName("b.billing.test.")},
+	)
+	dns.setA("a.billing.test.", [4]byte{10, 0, 0, 1})
+	dns.setA("b.billing.test.", [4]byte{10, 0, 0, 2})
+
+	cc := &fakeResolverClientConn{}
+	builder := grpcx.NewSRVResolverBuilder("grpcx-test-srv-unit", 20*time.Millisecond)
+
+	r, err := builder.Build(resolver.Target{URL: url.URL{Scheme: "grpcx-test-srv-unit", Host: dns.addr, Path: "/billing.test:443"}}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	t.Run("it should use the lowest priority records", func(t *testing.T) {
+		require.Eventually(t, func() bool {
+			state := cc.lastState()
+
+			return len(state.Addresses) == 1 && state.Addresses[0].Addr == "10.0.0.1:50051"
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.EqualValues(t, 5, grpcx.AddressWeight(cc.lastState().Addresses[0]))
+	})
+
+	t.Run("it should fall back to the next priority when targets do not resolve", func(t *testing.T) {
+		dns.setA("a.billing.test.")
+
+		require.Eventually(t, func() bool {
+			state := cc.lastState()
+
+			return len(state.Addresses) == 1 && state.Addresses[0].Addr == "10.0.0.2:50052"
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestParseClientConfigDial_SRVResolver(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resolver.Register(grpcx.NewSRVResolverBuilder("grpcx-test-srv", 20*time.Millisecond))
+
+	backend := startNamedTestServer(t, "billing")
+	_, port, err := net.SplitHostPort(backend)
+	require.NoError(t, err)
+
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	dns := startTestDNSServer(t)
+	dns.setSRV("_api._tcp.billing.test.", dnsmessage.SRVResource{Priority: 10, Weight: 1, Port: uint16(p), Target: dnsmessage.MustNewName("api.billing.test.")})
+	dns.setA("api.billing.test.", [4]byte{127, 0, 0, 1})
+
+	conn, err := grpcx.ParseClientConfigDial(ctx, "grpc://?tls=false&resolver.scheme=grpcx-test-srv&resolver.authority="+dns.addr+"&resolver.path=_api._tcp.billing.test")
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "billing"})
+	require.NoError(t, err)
+}
+
+func TestParseClientConfigDial_SRVResolverWeights(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resolver.Register(grpcx.NewSRVResolverBuilder("grpcx-test-srv-weights", 20*time.Millisecond))
+
+	dns := startTestDNSServer(t)
+	dns.setA("api.billing.test.", [4]byte{127, 0, 0, 1})
+
+	// The last backend has a weight of zero, so it is only used when the
+	// others are not available.
+	weights := []uint16{30, 10, 0}
+	hits := make([]*atomic.Int64, len(weights))
+	records := make([]dnsmessage.SRVResource, len(weights))
+
+	for i, weight := range weights {
+		addr, h := startCountingTestServer(t)
+		hits[i] = h
+
+		_, port, err := net.SplitHostPort(addr)
+		require.NoError(t, err)
+
+		p, err := strconv.Atoi(port)
+		require.NoError(t, err)
+
+		records[i] = dnsmessage.SRVResource{Priority: 10, Weight: weight, Port: uint16(p), Target: dnsmessage.MustNewName("api.billing.test.")}
+	}
+
+	dns.setSRV("_api._tcp.billing.test.", records...)
+
+	conn, err := grpcx.ParseClientConfigDial(ctx, "grpc://?tls=false&defaultServiceConfig=lbp-grpcx_weighted_round_robin&resolver.scheme=grpcx-test-srv-weights&resolver.authority="+dns.addr+"&resolver.path=_api._tcp.billing.test")
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	// Once every connection is ready, calls are split by weight.
+	require.Eventually(t, func() bool {
+		for _, h := range hits {
+			h.Store(0)
+		}
+
+		for i := 0; i < 40; i++ {
+			if _, cErr := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); cErr != nil {
+				return false
+			}
+		}
+
+		return hits[0].Load() == 30 && hits[1].Load() == 10 && hits[2].Load() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// testDNSServer is an in-process DNS server answering SRV and A queries from
+// a fixed set of records.
+type testDNSServer struct {
+	addr string
+
+	mu  sync.Mutex
+	srv map[string][]dnsmessage.SRVResource
+	a   map[string][][4]byte
+}
+
+func startTestDNSServer(t *testing.T) *testDNSServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = pc.Close() })
+
+	s := &testDNSServer{
+		addr: pc.LocalAddr().String(),
+		srv:  make(map[string][]dnsmessage.SRVResource),
+		a:    make(map[string][][4]byte),
+	}
+
+	go func() {
+		buf := make([]byte, 1500)
+
+		for {
+			n, addr, rErr := pc.ReadFrom(buf)
+			if rErr != nil {
+				return
+			}
+
+			if msg, ok := s.answer(buf[:n]); ok {
+				_, _ = pc.WriteTo(msg, addr)
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *testDNSServer) setSRV(name string, records ...dnsmessage.SRVResource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.srv[name] = records
+}
+
+func (s *testDNSServer) setA(name string, ips ...[4]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.a[name] = ips
+}
+
+func (s *testDNSServer) answer(query []byte) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var p dnsmessage.Parser
+
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, false
+	}
+
+	q, err := p.Question()
+	if err != nil {
+		return nil, false
+	}
+
+	name := q.Name.String()
+	srv, a := s.srv[name], s.a[name]
+
+	header := dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, RecursionDesired: h.RecursionDesired, RecursionAvailable: true}
+	if len(srv) == 0 && len(a) == 0 {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, header)
+	_ = b.StartQuestions()
+	_ = b.Question(q)
+	_ = b.StartAnswers()
+
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 1}
+
+	switch q.Type {
+	case dnsmessage.TypeSRV:
+		for _, r := range srv {
+			_ = b.SRVResource(rh, r)
+		}
+	case dnsmessage.TypeA:
+		for _, ip := range a {
+			_ = b.AResource(rh, dnsmessage.AResource{A: ip})
+		}
+	}
+
+	msg, err := b.Finish()
+
+	return msg, err == nil
+}